@@ -0,0 +1,116 @@
+/**
+ * Unit tests for src/archive.ts
+ */
+
+import childProcess from 'child_process'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import {
+  archiveType,
+  extractArchive,
+  safeExtractPath,
+  sourceRoot
+} from '../src/archive'
+
+describe('archiveType', () => {
+  it('detects tarballs and zip files', () => {
+    expect(archiveType('gop-1.2.3.tar.gz')).toBe('tar.gz')
+    expect(archiveType('/tmp/gop.TGZ')).toBe('tar.gz')
+    expect(archiveType('v1.2.3.zip')).toBe('zip')
+  })
+
+  it('rejects other files', () => {
+    expect(() => archiveType('gop-1.2.3.tar.xz')).toThrow(
+      'Unsupported archive gop-1.2.3.tar.xz, expected a .tar.gz, .tgz or .zip file'
+    )
+  })
+})
+
+describe('safeExtractPath', () => {
+  const dest = path.resolve('/tmp/extract')
+
+  it('resolves entries inside dest', () => {
+    expect(safeExtractPath(dest, 'gop-1.2.3/go.mod')).toBe(
+      path.join(dest, 'gop-1.2.3', 'go.mod')
+    )
+    expect(safeExtractPath(dest, './')).toBe(dest)
+    expect(safeExtractPath(dest, 'a/../b')).toBe(path.join(dest, 'b'))
+    expect(safeExtractPath(dest, 'bin\\gop.exe')).toBe(
+      path.join(dest, 'bin', 'gop.exe')
+    )
+  })
+
+  it('rejects entries climbing out of dest with ..', () => {
+    expect(() => safeExtractPath(dest, '../../etc/passwd')).toThrow(
+      `Refusing to extract archive entry '../../etc/passwd', it escapes ${dest}`
+    )
+    expect(() => safeExtractPath(dest, 'gop/../../x')).toThrow('escapes')
+    expect(() => safeExtractPath(dest, '..')).toThrow('escapes')
+    expect(() => safeExtractPath(dest, '..\\..\\evil.exe')).toThrow(
+      'escapes'
+    )
+  })
+
+  it('rejects a sibling directory sharing the prefix of dest', () => {
+    expect(() => safeExtractPath(dest, '../extract-evil/x')).toThrow(
+      'escapes'
+    )
+  })
+
+  it('rejects absolute entries', () => {
+    expect(() => safeExtractPath(dest, '/etc/passwd')).toThrow(
+      "Refusing to extract archive entry '/etc/passwd'"
+    )
+    expect(() => safeExtractPath(dest, '\\\\server\\share\\x')).toThrow(
+      'escapes'
+    )
+    expect(() => safeExtractPath(dest, 'C:\\Windows\\evil.dll')).toThrow(
+      'escapes'
+    )
+    expect(() => safeExtractPath(dest, 'c:/evil')).toThrow('escapes')
+  })
+})
+
+describe('extractArchive', () => {
+  afterEach(() => {
+    jest.restoreAllMocks()
+  })
+
+  it('extracts nothing from an archive with a zip-slip entry', () => {
+    const execFileSync = jest.spyOn(childProcess, 'execFileSync')
+
+    expect(() =>
+      extractArchive('/tmp/gop.zip', '/tmp/extract', () => [
+        'gop/go.mod',
+        'gop/../../../home/runner/.bashrc'
+      ])
+    ).toThrow(
+      "Refusing to extract archive entry 'gop/../../../home/runner/.bashrc'"
+    )
+    expect(execFileSync).not.toHaveBeenCalled()
+  })
+})
+
+describe('sourceRoot', () => {
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+  })
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('unwraps the single directory of a source archive', () => {
+    fs.mkdirSync(path.join(tmpDir, 'gop-1.2.3'))
+    expect(sourceRoot(tmpDir)).toBe(path.join(tmpDir, 'gop-1.2.3'))
+  })
+
+  it('keeps a tree extracted at the top level', () => {
+    fs.writeFileSync(path.join(tmpDir, 'go.mod'), '')
+    fs.mkdirSync(path.join(tmpDir, 'cmd'))
+    expect(sourceRoot(tmpDir)).toBe(tmpDir)
+  })
+})
@@ -0,0 +1,79 @@
+/**
+ * Unit tests for src/binary-alias.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { createBinaryAliases } from '../src/binary-alias'
+
+describe('createBinaryAliases', () => {
+  let binDir: string
+  const originalPath = process.env['PATH']
+
+  beforeEach(() => {
+    binDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-bin-'))
+    process.env['PATH'] = binDir
+  })
+
+  afterEach(() => {
+    process.env['PATH'] = originalPath
+    fs.rmSync(binDir, { recursive: true, force: true })
+  })
+
+  it('symlinks aliases to gop on Unix', () => {
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+
+    const created = createBinaryAliases(binDir, ['goplus'], {
+      platform: 'linux'
+    })
+
+    const alias = path.join(binDir, 'goplus')
+    expect(created).toEqual([alias])
+    expect(fs.lstatSync(alias).isSymbolicLink()).toBe(true)
+    expect(fs.readlinkSync(alias)).toBe(path.join(binDir, 'gop'))
+  })
+
+  it('copies gop.exe to aliases on Windows', () => {
+    fs.writeFileSync(path.join(binDir, 'gop.exe'), 'gop binary')
+
+    const created = createBinaryAliases(binDir, ['goplus'], {
+      platform: 'win32'
+    })
+
+    const alias = path.join(binDir, 'goplus.exe')
+    expect(created).toEqual([alias])
+    expect(fs.lstatSync(alias).isSymbolicLink()).toBe(false)
+    expect(fs.readFileSync(alias).toString()).toBe('gop binary')
+  })
+
+  it('refuses to shadow an existing binary without force', () => {
+    const otherDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    try {
+      fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+      fs.writeFileSync(path.join(otherDir, 'goplus'), 'other binary')
+      process.env['PATH'] = [otherDir, binDir].join(':')
+
+      expect(() =>
+        createBinaryAliases(binDir, ['goplus'], { platform: 'linux' })
+      ).toThrow(/collides with/)
+      expect(
+        createBinaryAliases(binDir, ['goplus'], {
+          platform: 'linux',
+          force: true
+        })
+      ).toEqual([path.join(binDir, 'goplus')])
+    } finally {
+      fs.rmSync(otherDir, { recursive: true, force: true })
+    }
+  })
+  it('refuses aliases replacing a gop binary', () => {
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+
+    for (const alias of ['gop', 'gopfmt', 'gop.exe', 'gopfmt.exe', 'GOP']) {
+      expect(() =>
+        createBinaryAliases(binDir, [alias], { platform: 'linux' })
+      ).toThrow(`Invalid binary alias '${alias}'`)
+    }
+  })
+})
@@ -0,0 +1,210 @@
+/**
+ * Unit tests for src/cache.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import {
+  binaryCacheDir,
+  cacheDirKey,
+  gopBinaries,
+  readCacheManifest,
+  readRefsCache,
+  REFS_TTL,
+  restoreBinaries,
+  restoreCacheDir,
+  saveBinaries,
+  writeCacheDir,
+  writeRefsCache
+} from '../src/cache'
+
+describe('cache', () => {
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+  })
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('keys the cache by version and build flags', () => {
+    expect(binaryCacheDir('1.2.0', {}, '/cache')).toBe(
+      path.join('/cache', '1.2.0')
+    )
+    expect(
+      binaryCacheDir('1.2.0', { race: true, tags: ['b', 'a'] }, '/cache')
+    ).toBe(path.join('/cache', '1.2.0-race-tags-a_b'))
+    expect(
+      binaryCacheDir('1.2.0', { repo: 'https://example.com/gop.git' }, '/cache')
+    ).toMatch(/1\.2\.0-repo-[0-9a-f]{12}$/)
+    expect(
+      binaryCacheDir('1.2.0', { command: 'make install' }, '/cache')
+    ).toMatch(/1\.2\.0-cmd-[0-9a-f]{12}$/)
+    expect(
+      binaryCacheDir('1.2.0', { env: { CGO_ENABLED: '0' } }, '/cache')
+    ).toMatch(/1\.2\.0-env-[0-9a-f]{12}$/)
+  })
+
+  it('lists only gop binaries', () => {
+    fs.writeFileSync(path.join(tmpDir, 'gop'), '')
+    fs.writeFileSync(path.join(tmpDir, 'gopfmt'), '')
+    fs.writeFileSync(path.join(tmpDir, 'gopfmt.exe'), '')
+    fs.writeFileSync(path.join(tmpDir, 'golangci-lint'), '')
+    fs.writeFileSync(path.join(tmpDir, 'gopls'), '')
+    fs.writeFileSync(path.join(tmpDir, 'gop-1.1.0'), '')
+    fs.mkdirSync(path.join(tmpDir, 'gop.d'))
+
+    expect(gopBinaries(tmpDir).sort()).toEqual(['gop', 'gopfmt', 'gopfmt.exe'])
+    expect(gopBinaries(path.join(tmpDir, 'missing'))).toEqual([])
+  })
+
+  it('saves and restores binaries', () => {
+    const binDir = path.join(tmpDir, 'bin')
+    const cacheDir = path.join(tmpDir, 'cache', '1.2.0')
+    fs.mkdirSync(binDir)
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+    fs.writeFileSync(path.join(binDir, 'other'), 'other binary')
+
+    saveBinaries(binDir, cacheDir)
+    expect(fs.readdirSync(cacheDir)).toEqual(['gop'])
+    expect(fs.readdirSync(path.dirname(cacheDir))).toEqual(['1.2.0'])
+
+    const restoreDir = path.join(tmpDir, 'restored')
+    expect(restoreBinaries(cacheDir, restoreDir)).toBe(true)
+    expect(fs.readFileSync(path.join(restoreDir, 'gop')).toString()).toBe(
+      'gop binary'
+    )
+  })
+
+  it('saves and restores the gop root with the binaries', () => {
+    const binDir = path.join(tmpDir, 'bin')
+    const rootDir = path.join(tmpDir, 'root')
+    const cacheDir = path.join(tmpDir, 'cache', '1.2.0')
+    fs.mkdirSync(binDir)
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+    fs.mkdirSync(path.join(rootDir, '.git'), { recursive: true })
+    fs.writeFileSync(path.join(rootDir, 'go.mod'), 'module gop')
+
+    saveBinaries(binDir, cacheDir, rootDir)
+    expect(fs.readdirSync(cacheDir).sort()).toEqual(['gop', 'root'])
+
+    const restoredRoot = path.join(tmpDir, 'restored-root')
+    expect(
+      restoreBinaries(cacheDir, path.join(tmpDir, 'restored'), restoredRoot)
+    ).toBe(true)
+    expect(fs.readdirSync(restoredRoot)).toEqual(['go.mod'])
+  })
+
+  it('misses binaries cached without their gop root', () => {
+    const cacheDir = path.join(tmpDir, 'cache', '1.2.0')
+    fs.mkdirSync(cacheDir, { recursive: true })
+    fs.writeFileSync(path.join(cacheDir, 'gop'), 'gop binary')
+    const restoreDir = path.join(tmpDir, 'restored')
+
+    expect(
+      restoreBinaries(cacheDir, restoreDir, path.join(tmpDir, 'root'))
+    ).toBe(false)
+    expect(fs.existsSync(restoreDir)).toBe(false)
+  })
+
+  it('replaces a previous cache entry', () => {
+    const binDir = path.join(tmpDir, 'bin')
+    const cacheDir = path.join(tmpDir, 'cache', '1.2.0')
+    fs.mkdirSync(binDir)
+    fs.mkdirSync(cacheDir, { recursive: true })
+    fs.writeFileSync(path.join(cacheDir, 'gopstale'), '')
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+
+    saveBinaries(binDir, cacheDir)
+
+    expect(fs.readdirSync(cacheDir)).toEqual(['gop'])
+  })
+
+  it('keys the cache-dir by version, build flags and platform', () => {
+    expect(cacheDirKey('1.2.0', 'linux-amd64')).toBe(
+      'setup-goplus-gop-1.2.0-linux-amd64'
+    )
+    expect(cacheDirKey('1.2.0', 'darwin-arm64', { race: true })).toBe(
+      'setup-goplus-gop-1.2.0-race-darwin-arm64'
+    )
+  })
+
+  it('writes and reads the cache-dir manifest', () => {
+    const binDir = path.join(tmpDir, 'bin')
+    const dir = path.join(tmpDir, 'persist')
+    fs.mkdirSync(binDir)
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+    const manifest = {
+      key: 'setup-goplus-gop-1.2.0-linux-amd64',
+      version: '1.2.0',
+      commit: '0123456789abcdef0123456789abcdef01234567',
+      platform: 'linux-amd64'
+    }
+
+    expect(readCacheManifest(dir)).toBeNull()
+    writeCacheDir(binDir, dir, manifest)
+    expect(fs.readdirSync(dir).sort()).toEqual(['gop', 'manifest.json'])
+    expect(readCacheManifest(dir)).toEqual(manifest)
+
+    const restoreDir = path.join(tmpDir, 'restored')
+    expect(restoreCacheDir(dir, restoreDir, manifest.key)).toBe(true)
+    expect(fs.readFileSync(path.join(restoreDir, 'gop')).toString()).toBe(
+      'gop binary'
+    )
+  })
+
+  it('skips a cache-dir holding another key', () => {
+    const binDir = path.join(tmpDir, 'bin')
+    const dir = path.join(tmpDir, 'persist')
+    fs.mkdirSync(binDir)
+    fs.writeFileSync(path.join(binDir, 'gop'), 'gop binary')
+    writeCacheDir(binDir, dir, {
+      key: 'setup-goplus-gop-1.2.0-linux-amd64',
+      version: '1.2.0',
+      commit: '',
+      platform: 'linux-amd64'
+    })
+
+    const restoreDir = path.join(tmpDir, 'restored')
+    expect(
+      restoreCacheDir(dir, restoreDir, 'setup-goplus-gop-1.2.1-linux-amd64')
+    ).toBe(false)
+    expect(fs.existsSync(restoreDir)).toBe(false)
+  })
+
+  it('ignores an invalid cache-dir manifest', () => {
+    fs.writeFileSync(path.join(tmpDir, 'manifest.json'), '{"version":')
+    expect(readCacheManifest(tmpDir)).toBeNull()
+    fs.writeFileSync(path.join(tmpDir, 'manifest.json'), '{}')
+    expect(readCacheManifest(tmpDir)).toBeNull()
+  })
+
+  it('reuses listed refs within the TTL', () => {
+    const key = 'https://github.com/goplus/gop.git --tags'
+    writeRefsCache(key, 'abc\trefs/tags/v1.2.0\n', 1000, tmpDir)
+
+    expect(readRefsCache(key, REFS_TTL, 1000 + REFS_TTL, tmpDir)).toBe(
+      'abc\trefs/tags/v1.2.0\n'
+    )
+    expect(readRefsCache(key, REFS_TTL, 1001 + REFS_TTL, tmpDir)).toBeNull()
+  })
+
+  it('keys listed refs by repo', () => {
+    writeRefsCache('https://github.com/goplus/gop.git --tags', 'a', 0, tmpDir)
+    writeRefsCache('https://example.com/gop.git --tags', 'b', 0, tmpDir)
+
+    expect(
+      readRefsCache('https://example.com/gop.git --tags', REFS_TTL, 0, tmpDir)
+    ).toBe('b')
+    expect(
+      readRefsCache('https://example.com/gop.git --heads', REFS_TTL, 0, tmpDir)
+    ).toBeNull()
+  })
+
+  it('misses when nothing is cached', () => {
+    expect(restoreBinaries(path.join(tmpDir, 'missing'), tmpDir)).toBe(false)
+  })
+})
@@ -0,0 +1,64 @@
+/**
+ * Unit tests for src/checksum.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { parseChecksums, verifyChecksum } from '../src/checksum'
+
+// SHA256 of 'gop archive'.
+const GOP_ARCHIVE_SHA256 =
+  '9009e39e37861ec64ac9eb86dcc12c7c9cb1f6b4e8f545d537e75a0ba2beeb71'
+
+describe('verifyChecksum', () => {
+  let tmpDir: string
+  let archive: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    archive = path.join(tmpDir, 'gop_v1.2.0_linux_amd64.tar.gz')
+    fs.writeFileSync(archive, 'gop archive')
+  })
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('accepts a matching checksum in any case', () => {
+    expect(() => verifyChecksum(archive, GOP_ARCHIVE_SHA256)).not.toThrow()
+    expect(() =>
+      verifyChecksum(archive, ` ${GOP_ARCHIVE_SHA256.toUpperCase()}\n`)
+    ).not.toThrow()
+  })
+
+  it('rejects a mismatching checksum', () => {
+    expect(() => verifyChecksum(archive, '0'.repeat(64))).toThrow(
+      `Checksum mismatch for gop_v1.2.0_linux_amd64.tar.gz: expected ${'0'.repeat(64)}, got ${GOP_ARCHIVE_SHA256}`
+    )
+  })
+
+  it('rejects a malformed checksum', () => {
+    expect(() => verifyChecksum(archive, 'abc')).toThrow(
+      "Invalid SHA256 checksum 'abc'"
+    )
+  })
+})
+
+describe('parseChecksums', () => {
+  const contents = [
+    `${'a'.repeat(64)}  gop_v1.2.0_darwin_arm64.tar.gz`,
+    `${'B'.repeat(64)} *gop_v1.2.0_linux_amd64.tar.gz`,
+    ''
+  ].join('\n')
+
+  it('finds the checksum of a file', () => {
+    expect(parseChecksums(contents, 'gop_v1.2.0_linux_amd64.tar.gz')).toBe(
+      'b'.repeat(64)
+    )
+  })
+
+  it('returns an empty string for an unlisted file', () => {
+    expect(parseChecksums(contents, 'gop_v1.2.0_windows_amd64.zip')).toBe('')
+  })
+})
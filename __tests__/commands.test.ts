@@ -0,0 +1,120 @@
+/**
+ * Unit tests for src/commands.ts
+ */
+
+import * as core from '@actions/core'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { addPath, setEnv, setOutput } from '../src/commands'
+
+describe('setEnv', () => {
+  const githubEnv = process.env['GITHUB_ENV']
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    jest.spyOn(core, 'warning').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    if (githubEnv === undefined) {
+      delete process.env['GITHUB_ENV']
+    } else {
+      process.env['GITHUB_ENV'] = githubEnv
+    }
+    delete process.env['GOP_VERSION']
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('appends the variable to GITHUB_ENV', () => {
+    const envFile = path.join(tmpDir, 'env')
+    fs.writeFileSync(envFile, '')
+    process.env['GITHUB_ENV'] = envFile
+
+    setEnv('GOP_VERSION', '1.2.0')
+
+    expect(fs.readFileSync(envFile).toString()).toMatch(
+      /^GOP_VERSION<<(.+)\n1\.2\.0\n\1\n$/
+    )
+    expect(process.env['GOP_VERSION']).toBe('1.2.0')
+  })
+
+  it('sets the variable for this process without GITHUB_ENV', () => {
+    delete process.env['GITHUB_ENV']
+
+    setEnv('GOP_VERSION', '1.2.0')
+
+    expect(process.env['GOP_VERSION']).toBe('1.2.0')
+    expect(core.warning).toHaveBeenCalledWith(
+      'GITHUB_ENV is not set, GOP_VERSION is only set for this process'
+    )
+  })
+})
+
+describe('setOutput', () => {
+  const githubOutput = process.env['GITHUB_OUTPUT']
+
+  beforeEach(() => {
+    jest.spyOn(core, 'warning').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    if (githubOutput !== undefined) {
+      process.env['GITHUB_OUTPUT'] = githubOutput
+    }
+  })
+
+  it('logs the output instead of failing without GITHUB_OUTPUT', () => {
+    delete process.env['GITHUB_OUTPUT']
+
+    expect(() => setOutput('gop-version', '1.2.0')).not.toThrow()
+    expect(() => setOutput('cache-hit', false)).not.toThrow()
+    expect(core.warning).toHaveBeenCalledWith(
+      'GITHUB_OUTPUT is not set, skipped output gop-version=1.2.0'
+    )
+    expect(core.warning).toHaveBeenCalledWith(
+      'GITHUB_OUTPUT is not set, skipped output cache-hit=false'
+    )
+  })
+})
+
+describe('addPath', () => {
+  const githubPath = process.env['GITHUB_PATH']
+  const envPath = process.env['PATH']
+
+  beforeEach(() => {
+    jest.spyOn(core, 'warning').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    process.env['PATH'] = envPath
+    if (githubPath !== undefined) {
+      process.env['GITHUB_PATH'] = githubPath
+    }
+  })
+
+  it('still updates PATH of this process without GITHUB_PATH', () => {
+    delete process.env['GITHUB_PATH']
+    const bin = path.join(os.homedir(), 'bin')
+
+    expect(() => addPath(bin)).not.toThrow()
+    expect(process.env['PATH']?.split(path.delimiter)[0]).toBe(bin)
+    expect(core.warning).toHaveBeenCalled()
+  })
+
+  it('joins PATH with the separator of the platform', () => {
+    delete process.env['GITHUB_PATH']
+    process.env['PATH'] = 'C:\\Windows'
+
+    addPath('C:\\Users\\runner\\bin', 'win32')
+    expect(process.env['PATH']).toBe('C:\\Users\\runner\\bin;C:\\Windows')
+
+    process.env['PATH'] = '/usr/bin'
+    addPath('/home/runner/bin', 'linux')
+    expect(process.env['PATH']).toBe('/home/runner/bin:/usr/bin')
+  })
+})
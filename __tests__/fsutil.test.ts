@@ -0,0 +1,128 @@
+/**
+ * Unit tests for src/fsutil.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import {
+  ensureExecutable,
+  ensureWritableDir,
+  expandHome,
+  movePath,
+  resolveDir
+} from '../src/fsutil'
+
+describe('fsutil', () => {
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.realpathSync(
+      fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    )
+  })
+
+  afterEach(() => {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('resolves a symlinked home for a directory that does not exist', () => {
+    const realHome = path.join(tmpDir, 'real-home')
+    const home = path.join(tmpDir, 'home')
+    fs.mkdirSync(realHome)
+    fs.symlinkSync(realHome, home, 'junction')
+
+    expect(resolveDir(path.join(home, 'bin'))).toBe(path.join(realHome, 'bin'))
+  })
+
+  it('renames within a file system', () => {
+    const src = path.join(tmpDir, 'src')
+    fs.mkdirSync(src)
+    fs.writeFileSync(path.join(src, 'gop'), 'gop binary')
+
+    movePath(src, path.join(tmpDir, 'dest'))
+
+    expect(fs.existsSync(src)).toBe(false)
+    expect(fs.readFileSync(path.join(tmpDir, 'dest', 'gop')).toString()).toBe(
+      'gop binary'
+    )
+  })
+
+  it('falls back to copying when a rename crosses file systems', () => {
+    const src = path.join(tmpDir, 'src')
+    const dest = path.join(tmpDir, 'dest')
+    fs.mkdirSync(src)
+    fs.writeFileSync(path.join(src, 'gop'), 'gop binary')
+    const crossDeviceRename = (): void => {
+      const error: NodeJS.ErrnoException = new Error('cross-device link')
+      error.code = 'EXDEV'
+      throw error
+    }
+
+    movePath(src, dest, crossDeviceRename)
+
+    expect(fs.existsSync(src)).toBe(false)
+    expect(fs.readFileSync(path.join(dest, 'gop')).toString()).toBe(
+      'gop binary'
+    )
+  })
+
+  it('propagates other rename failures', () => {
+    const failingRename = (): void => {
+      const error: NodeJS.ErrnoException = new Error('permission denied')
+      error.code = 'EACCES'
+      throw error
+    }
+    expect(() =>
+      movePath(path.join(tmpDir, 'a'), path.join(tmpDir, 'b'), failingRename)
+    ).toThrow('permission denied')
+  })
+
+  it('expands a leading tilde to the home directory', () => {
+    expect(expandHome('~', '/home/runner')).toBe('/home/runner')
+    expect(expandHome('~/tools/bin', '/home/runner')).toBe(
+      path.join('/home/runner', 'tools', 'bin')
+    )
+  })
+
+  it('passes other paths through unchanged', () => {
+    expect(expandHome('/opt/gop/bin', '/home/runner')).toBe('/opt/gop/bin')
+    expect(expandHome('tools/~/bin', '/home/runner')).toBe('tools/~/bin')
+    expect(expandHome('~runner/bin', '/home/runner')).toBe('~runner/bin')
+    expect(expandHome('', '/home/runner')).toBe('')
+  })
+
+  it('creates a missing install dir', () => {
+    const dir = path.join(tmpDir, 'tools', 'bin')
+
+    ensureWritableDir(dir)
+
+    expect(fs.statSync(dir).isDirectory()).toBe(true)
+  })
+
+  it('rejects an install dir that cannot be created', () => {
+    const file = path.join(tmpDir, 'file')
+    fs.writeFileSync(file, '')
+
+    expect(() => ensureWritableDir(path.join(file, 'bin'))).toThrow(
+      `Unable to install to ${path.join(file, 'bin')}, it is not writable`
+    )
+  })
+
+  it('adds missing execute bits to a binary', () => {
+    const gop = path.join(tmpDir, 'gop')
+    fs.writeFileSync(gop, '#!/bin/sh\n', { mode: 0o644 })
+
+    expect(ensureExecutable(gop, 'linux')).toBe(true)
+    expect(fs.statSync(gop).mode & 0o111).not.toBe(0)
+    expect(ensureExecutable(gop, 'linux')).toBe(false)
+  })
+
+  it('leaves binaries on Windows alone', () => {
+    const gop = path.join(tmpDir, 'gop.exe')
+    fs.writeFileSync(gop, '', { mode: 0o644 })
+
+    expect(ensureExecutable(gop, 'win32')).toBe(false)
+    expect(fs.statSync(gop).mode & 0o111).toBe(0)
+  })
+})
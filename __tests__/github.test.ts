@@ -0,0 +1,70 @@
+/**
+ * Unit tests for src/github.ts
+ */
+
+import {
+  githubApiUrl,
+  githubServerUrl,
+  isGitHubUrl,
+  releasesApiUrl,
+  upstreamRepo
+} from '../src/github'
+
+describe('githubServerUrl', () => {
+  it('prefers the input, then the runner, then github.com', () => {
+    const env = { GITHUB_SERVER_URL: 'https://ghes.example.com' }
+    expect(githubServerUrl('https://git.example.com/', env)).toBe(
+      'https://git.example.com'
+    )
+    expect(githubServerUrl('', env)).toBe('https://ghes.example.com')
+    expect(githubServerUrl('', {})).toBe('https://github.com')
+  })
+
+  it('rejects a URL that is not http(s)', () => {
+    expect(() => githubServerUrl('ghes.example.com', {})).toThrow(
+      "Invalid github-server-url 'ghes.example.com', expected an http(s) URL"
+    )
+    expect(() => githubServerUrl('ftp://ghes.example.com', {})).toThrow(
+      'expected an http(s) URL'
+    )
+  })
+})
+
+describe('GitHub URLs', () => {
+  it('builds the URLs of github.com', () => {
+    expect(githubApiUrl('https://github.com')).toBe('https://api.github.com')
+    expect(upstreamRepo('https://github.com')).toBe(
+      'https://github.com/goplus/gop.git'
+    )
+    expect(releasesApiUrl('https://github.com')).toBe(
+      'https://api.github.com/repos/goplus/gop/releases'
+    )
+  })
+
+  it('builds the URLs of a GitHub Enterprise Server', () => {
+    const server = 'https://ghes.example.com'
+    expect(githubApiUrl(server)).toBe('https://ghes.example.com/api/v3')
+    expect(upstreamRepo(server)).toBe('https://ghes.example.com/goplus/gop.git')
+    expect(releasesApiUrl(server)).toBe(
+      'https://ghes.example.com/api/v3/repos/goplus/gop/releases'
+    )
+  })
+})
+
+describe('isGitHubUrl', () => {
+  it('accepts the web and API hosts of the instance', () => {
+    const github = 'https://github.com'
+    expect(isGitHubUrl('https://github.com/goplus/gop', github)).toBe(true)
+    expect(isGitHubUrl('https://api.github.com/repos', github)).toBe(true)
+    const ghes = 'https://ghes.example.com'
+    expect(isGitHubUrl('https://ghes.example.com/api/v3/x', ghes)).toBe(true)
+  })
+
+  it('rejects other hosts', () => {
+    const github = 'https://github.com'
+    expect(isGitHubUrl('https://example.org/SHA256SUMS', github)).toBe(false)
+    expect(isGitHubUrl('https://github.com.evil.org/x', github)).toBe(false)
+    expect(isGitHubUrl('https://github.com/x', 'https://ghes.corp')).toBe(false)
+    expect(isGitHubUrl('not a url', github)).toBe(false)
+  })
+})
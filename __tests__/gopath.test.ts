@@ -0,0 +1,82 @@
+/**
+ * Unit tests for src/gopath.ts
+ */
+
+import * as core from '@actions/core'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { createGopathLayout } from '../src/gopath'
+
+describe('createGopathLayout', () => {
+  let tmpDir: string
+  let exportVariableMock: jest.SpyInstance
+  const githubEnv = process.env['GITHUB_ENV']
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    process.env['GITHUB_ENV'] = path.join(tmpDir, 'github_env')
+    exportVariableMock = jest
+      .spyOn(core, 'exportVariable')
+      .mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    if (githubEnv === undefined) {
+      delete process.env['GITHUB_ENV']
+    } else {
+      process.env['GITHUB_ENV'] = githubEnv
+    }
+    exportVariableMock.mockRestore()
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('links the source into GOPATH and exports GOPATH', () => {
+    const gopDir = path.join(tmpDir, 'workdir', 'gop')
+    fs.mkdirSync(gopDir, { recursive: true })
+    fs.writeFileSync(
+      path.join(gopDir, 'go.mod'),
+      'module github.com/goplus/gop'
+    )
+    const gopath = path.join(tmpDir, 'go')
+
+    const target = createGopathLayout(gopDir, gopath)
+
+    expect(target).toBe(path.join(gopath, 'src/github.com/goplus/gop'))
+    expect(fs.readFileSync(path.join(target, 'go.mod')).toString()).toBe(
+      'module github.com/goplus/gop'
+    )
+    expect(exportVariableMock).toHaveBeenCalledWith('GOPATH', gopath)
+  })
+
+  it('replaces a stale link from a previous run', () => {
+    const gopath = path.join(tmpDir, 'go')
+    const oldDir = path.join(tmpDir, 'old')
+    const newDir = path.join(tmpDir, 'new')
+    fs.mkdirSync(oldDir)
+    fs.mkdirSync(newDir)
+    fs.writeFileSync(path.join(newDir, 'VERSION'), 'new')
+
+    createGopathLayout(oldDir, gopath)
+    const target = createGopathLayout(newDir, gopath)
+
+    expect(fs.readFileSync(path.join(target, 'VERSION')).toString()).toBe('new')
+    expect(fs.existsSync(oldDir)).toBe(true)
+  })
+  it('never deletes a real checkout in GOPATH', () => {
+    const gopath = path.join(tmpDir, 'go')
+    const checkout = path.join(gopath, 'src/github.com/goplus/gop')
+    fs.mkdirSync(checkout, { recursive: true })
+    fs.writeFileSync(path.join(checkout, 'main.go'), 'package main')
+    const gopDir = path.join(tmpDir, 'workdir', 'gop')
+    fs.mkdirSync(gopDir, { recursive: true })
+
+    expect(() => createGopathLayout(gopDir, gopath)).toThrow(
+      `${checkout} already exists and is not a link`
+    )
+    expect(fs.readFileSync(path.join(checkout, 'main.go')).toString()).toBe(
+      'package main'
+    )
+    expect(exportVariableMock).not.toHaveBeenCalled()
+  })
+})
@@ -0,0 +1,60 @@
+/**
+ * Unit tests for src/goproot.ts
+ */
+
+import * as core from '@actions/core'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { copyGopRoot, gopRootDir, moveToGopRoot } from '../src/goproot'
+
+describe('gopRootDir', () => {
+  it('gives each bin dir its own root', () => {
+    const home = path.join(os.tmpdir(), 'home')
+    const root = gopRootDir('/usr/local/bin', home)
+    expect(path.dirname(root)).toBe(path.join(home, '.setup-goplus', 'roots'))
+    expect(gopRootDir('/usr/local/bin/', home)).toBe(root)
+    expect(gopRootDir('/opt/gop/bin', home)).not.toBe(root)
+  })
+})
+
+describe('gop root', () => {
+  let tmpDir: string
+  let src: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    src = path.join(tmpDir, 'workdir', 'gop')
+    fs.mkdirSync(path.join(src, '.git'), { recursive: true })
+    fs.writeFileSync(path.join(src, '.git', 'HEAD'), 'ref: refs/heads/main\n')
+    fs.writeFileSync(path.join(src, 'go.mod'), 'module github.com/goplus/gop\n')
+    jest.spyOn(core, 'info').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('moves the source in place of a previous root', () => {
+    const root = path.join(tmpDir, 'roots', 'a')
+    fs.mkdirSync(root, { recursive: true })
+    fs.writeFileSync(path.join(root, 'stale'), '')
+
+    expect(moveToGopRoot(src, root)).toBe(root)
+
+    expect(fs.existsSync(src)).toBe(false)
+    expect(fs.readdirSync(root).sort()).toEqual(['.git', 'go.mod'])
+  })
+
+  it('copies a root without its git history', () => {
+    const dest = path.join(tmpDir, 'cache', 'root')
+    fs.mkdirSync(path.dirname(dest), { recursive: true })
+
+    copyGopRoot(src, dest)
+
+    expect(fs.readdirSync(dest)).toEqual(['go.mod'])
+    expect(fs.existsSync(path.join(src, '.git'))).toBe(true)
+    expect(fs.readdirSync(path.dirname(dest))).toEqual(['root'])
+  })
+})
@@ -0,0 +1,227 @@
+/**
+ * Unit tests for src/http.ts
+ */
+
+import * as core from '@actions/core'
+import { HttpClient, HttpClientResponse } from '@actions/http-client'
+import http from 'http'
+import { AddressInfo } from 'net'
+import { Readable } from 'stream'
+import {
+  applyProxy,
+  fetchViaProxy,
+  fetchWithRetry,
+  parseRetryAfter,
+  proxyForUrl
+} from '../src/http'
+
+describe('parseRetryAfter', () => {
+  it('parses delay seconds', () => {
+    expect(parseRetryAfter('120')).toBe(120000)
+  })
+
+  it('parses an HTTP-date', () => {
+    const now = Date.parse('Wed, 21 Oct 2015 07:28:00 GMT')
+    expect(parseRetryAfter('Wed, 21 Oct 2015 07:28:30 GMT', now)).toBe(30000)
+    expect(parseRetryAfter('Wed, 21 Oct 2015 07:27:00 GMT', now)).toBe(0)
+  })
+
+  it('rejects missing or invalid values', () => {
+    expect(parseRetryAfter(null)).toBeNull()
+    expect(parseRetryAfter('soon')).toBeNull()
+  })
+})
+
+describe('fetchWithRetry', () => {
+  let server: http.Server
+  let url: string
+  let responses: { status: number; headers?: Record<string, string> }[]
+  let requests: number
+  let waits: number[]
+
+  async function recordWait(ms: number): Promise<void> {
+    waits.push(ms)
+  }
+
+  beforeEach(async () => {
+    requests = 0
+    waits = []
+    server = http.createServer((_req, res) => {
+      const next = responses[Math.min(requests, responses.length - 1)]
+      requests++
+      res.writeHead(next.status, next.headers)
+      res.end(`status ${next.status}`)
+    })
+    await new Promise<void>(resolve => server.listen(0, '127.0.0.1', resolve))
+    url = `http://127.0.0.1:${(server.address() as AddressInfo).port}/`
+    jest.spyOn(core, 'warning').mockImplementation(() => {})
+  })
+
+  afterEach(async () => {
+    jest.restoreAllMocks()
+    await new Promise(resolve => server.close(resolve))
+  })
+
+  it('honors Retry-After on HTTP 429', async () => {
+    responses = [
+      { status: 429, headers: { 'Retry-After': '7' } },
+      { status: 200 }
+    ]
+
+    const res = await fetchWithRetry(url, {}, { sleep: recordWait })
+
+    expect(res.status).toBe(200)
+    expect(await res.text()).toBe('status 200')
+    expect(requests).toBe(2)
+    expect(waits).toEqual([7000])
+    expect(core.warning).toHaveBeenCalledWith(
+      expect.stringContaining('rate limited (HTTP 429)')
+    )
+  })
+
+  it('fails on a Retry-After longer than the limit', async () => {
+    responses = [{ status: 429, headers: { 'Retry-After': '3600' } }]
+
+    await expect(
+      fetchWithRetry(url, {}, { maxRetryAfter: 60000, sleep: recordWait })
+    ).rejects.toThrow(
+      `Request to ${url} was rate limited (HTTP 429), retry after 3600s`
+    )
+    expect(requests).toBe(1)
+    expect(waits).toEqual([])
+  })
+
+  it('backs off exponentially on server errors within the budget', async () => {
+    responses = [{ status: 503 }]
+
+    const res = await fetchWithRetry(
+      url,
+      {},
+      { retries: 2, backoff: 10, sleep: recordWait }
+    )
+
+    expect(res.status).toBe(503)
+    expect(requests).toBe(3)
+    expect(waits).toEqual([10, 20])
+  })
+})
+
+describe('proxyForUrl', () => {
+  const env = {
+    HTTPS_PROXY: 'http://proxy.corp:3128',
+    http_proxy: 'http://plain.corp:8080',
+    NO_PROXY: 'localhost, .internal.corp, mirror.corp:8443'
+  }
+
+  it('picks the proxy matching the scheme', () => {
+    expect(proxyForUrl('https://api.github.com/repos', env)).toBe(
+      'http://proxy.corp:3128'
+    )
+    expect(proxyForUrl('http://example.com/', env)).toBe(
+      'http://plain.corp:8080'
+    )
+  })
+
+  it('connects directly to hosts excluded by NO_PROXY', () => {
+    expect(proxyForUrl('http://localhost:8080/', env)).toBe('')
+    expect(proxyForUrl('https://git.internal.corp/gop.git', env)).toBe('')
+    expect(proxyForUrl('https://mirror.corp:8443/gop.git', env)).toBe('')
+    expect(proxyForUrl('https://mirror.corp/gop.git', env)).toBe(
+      'http://proxy.corp:3128'
+    )
+    expect(proxyForUrl('https://github.com/', { ...env, NO_PROXY: '*' })).toBe(
+      ''
+    )
+  })
+
+  it('connects directly without proxy variables', () => {
+    expect(proxyForUrl('https://github.com/', {})).toBe('')
+  })
+})
+
+describe('applyProxy', () => {
+  it('overrides the proxy variables', () => {
+    const env: NodeJS.ProcessEnv = { HTTPS_PROXY: 'http://old:1' }
+
+    applyProxy('http://proxy.corp:3128', env)
+
+    expect(env['HTTPS_PROXY']).toBe('http://proxy.corp:3128')
+    expect(env['http_proxy']).toBe('http://proxy.corp:3128')
+    expect(proxyForUrl('https://github.com/', env)).toBe(
+      'http://proxy.corp:3128'
+    )
+  })
+
+  it('rejects a proxy that is not a URL without echoing it', () => {
+    expect(() => applyProxy('user:secret@proxy', {})).toThrow(
+      'Invalid proxy, expected an http:// or https:// URL'
+    )
+  })
+})
+
+describe('fetchViaProxy', () => {
+  let server: http.Server
+  let url: string
+
+  beforeEach(async () => {
+    server = http.createServer((req, res) => {
+      res.writeHead(req.headers['authorization'] ? 200 : 401, {
+        'Content-Type': 'text/plain',
+        'Set-Cookie': ['a=1', 'b=2']
+      })
+      res.end(`${req.method} ${req.url}`)
+    })
+    await new Promise<void>(resolve => server.listen(0, '127.0.0.1', resolve))
+    url = `http://127.0.0.1:${(server.address() as AddressInfo).port}/x`
+  })
+
+  afterEach(async () => {
+    jest.restoreAllMocks()
+    await new Promise(resolve => server.close(resolve))
+  })
+
+  it('wraps the response like one of fetch', async () => {
+    const res = await fetchViaProxy(url, {
+      headers: { Authorization: 'Bearer t' }
+    })
+
+    expect(res.ok).toBe(true)
+    expect(res.headers.get('content-type')).toBe('text/plain')
+    expect(res.headers.get('set-cookie')).toBe('a=1, b=2')
+    expect(await res.text()).toBe('GET /x')
+    expect((await fetchViaProxy(url)).status).toBe(401)
+  })
+
+  it('is used by fetchWithRetry when a proxy applies', async () => {
+    const env = { ...process.env, HTTPS_PROXY: 'http://proxy.corp:3128' }
+    jest.replaceProperty(process, 'env', env)
+    const message = Object.assign(Readable.from(['ok']), {
+      statusCode: 200,
+      headers: {}
+    })
+    const request = jest
+      .spyOn(HttpClient.prototype, 'request')
+      .mockResolvedValue({ message } as unknown as HttpClientResponse)
+    const fetchMock = jest.spyOn(global, 'fetch')
+
+    const res = await fetchWithRetry('https://api.github.com/')
+
+    expect(await res.text()).toBe('ok')
+    expect(request).toHaveBeenCalledWith(
+      'GET',
+      'https://api.github.com/',
+      null,
+      {}
+    )
+    expect(fetchMock).not.toHaveBeenCalled()
+    // The client tunnels through the proxy of the environment.
+    const client = request.mock.contexts[0] as HttpClient
+    const agent = client.getAgent('https://api.github.com/') as unknown as {
+      proxyOptions: { host: string; port: string }
+    }
+    expect(agent.proxyOptions).toMatchObject({
+      host: 'proxy.corp',
+      port: '3128'
+    })
+  })
+})
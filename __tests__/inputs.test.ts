@@ -0,0 +1,47 @@
+/**
+ * Unit tests for src/inputs.ts
+ */
+
+import { formatDuration, getDurationInput, parseDuration } from '../src/inputs'
+
+describe('parseDuration', () => {
+  it('parses single and compound durations', () => {
+    expect(parseDuration('500ms')).toBe(500)
+    expect(parseDuration('90s')).toBe(90000)
+    expect(parseDuration('10m')).toBe(600000)
+    expect(parseDuration('1h30m')).toBe(5400000)
+    expect(parseDuration('1.5h')).toBe(5400000)
+  })
+
+  it('rejects durations without a unit or with garbage', () => {
+    for (const value of ['10', '10 m', 'm', '10d', '5m later']) {
+      expect(() => parseDuration(value)).toThrow(
+        `Invalid duration '${value}', expected e.g. 90s or 10m`
+      )
+    }
+  })
+})
+
+describe('formatDuration', () => {
+  it('uses the largest unit that divides the duration', () => {
+    expect(formatDuration(3600000)).toBe('1h')
+    expect(formatDuration(5400000)).toBe('90m')
+    expect(formatDuration(90000)).toBe('90s')
+    expect(formatDuration(1500)).toBe('1500ms')
+  })
+})
+
+describe('getDurationInput', () => {
+  afterEach(() => {
+    delete process.env['INPUT_BUILD_TIMEOUT']
+  })
+
+  it('returns 0 when the input is not set', () => {
+    expect(getDurationInput('BUILD_TIMEOUT')).toBe(0)
+  })
+
+  it('parses the input', () => {
+    process.env['INPUT_BUILD_TIMEOUT'] = ' 10m '
+    expect(getDurationInput('BUILD_TIMEOUT')).toBe(600000)
+  })
+})
@@ -0,0 +1,112 @@
+/**
+ * Unit tests for src/lock.ts
+ */
+
+import * as core from '@actions/core'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { lockPath, withLock } from '../src/lock'
+
+describe('lockPath', () => {
+  it('maps a directory to one lock file under the cache root', () => {
+    const file = lockPath('/home/runner/bin', '/cache')
+    expect(path.dirname(file)).toBe(path.join('/cache', 'locks'))
+    expect(lockPath('/home/runner/bin/', '/cache')).toBe(file)
+    expect(lockPath('/home/runner/.setup-goplus/1.2.0/bin', '/cache')).not.toBe(
+      file
+    )
+  })
+})
+
+describe('withLock', () => {
+  let tmpDir: string
+  let file: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    file = path.join(tmpDir, 'locks', 'bin.lock')
+    jest.spyOn(core, 'info').mockImplementation(() => {})
+    jest.spyOn(core, 'warning').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('runs concurrent installs to the same dir in turn', async () => {
+    const events: string[] = []
+    const install = async (name: string): Promise<string> =>
+      withLock(
+        file,
+        async () => {
+          events.push(`start ${name}`)
+          await new Promise(resolve => setTimeout(resolve, 20))
+          events.push(`end ${name}`)
+          return name
+        },
+        { poll: 5 }
+      )
+
+    const results = await Promise.all([install('a'), install('b')])
+
+    expect(results).toEqual(['a', 'b'])
+    expect(events).toEqual(['start a', 'end a', 'start b', 'end b'])
+    expect(fs.existsSync(file)).toBe(false)
+  })
+
+  it('releases the lock when fn throws', async () => {
+    await expect(
+      withLock(file, async () => {
+        throw new Error('build failed')
+      })
+    ).rejects.toThrow('build failed')
+    expect(fs.existsSync(file)).toBe(false)
+  })
+
+  it('takes over a lock whose process is gone', async () => {
+    fs.mkdirSync(path.dirname(file), { recursive: true })
+    fs.writeFileSync(file, '99999999')
+
+    await expect(withLock(file, async () => 'done')).resolves.toBe('done')
+    expect(core.warning).toHaveBeenCalledWith(
+      `Removing the stale lock ${file}`
+    )
+  })
+
+  it('leaves a stale lock to the waiter taking it over', async () => {
+    fs.mkdirSync(path.dirname(file), { recursive: true })
+    fs.writeFileSync(file, '99999999')
+    fs.writeFileSync(`${file}.takeover`, `${process.pid}`)
+
+    await expect(
+      withLock(file, async () => 'done', { timeout: 10, poll: 5 })
+    ).rejects.toThrow(`Timed out waiting for the lock ${file}`)
+    expect(fs.readFileSync(file).toString()).toBe('99999999')
+  })
+
+  it('removes the takeover guard of a killed waiter', async () => {
+    fs.mkdirSync(path.dirname(file), { recursive: true })
+    fs.writeFileSync(file, '99999999')
+    const guard = `${file}.takeover`
+    fs.writeFileSync(guard, '99999998')
+    const past = new Date(Date.now() - 60 * 1000)
+    fs.utimesSync(guard, past, past)
+
+    const result = await withLock(file, async () => 'done', { poll: 5 })
+
+    expect(result).toBe('done')
+    expect(fs.existsSync(guard)).toBe(false)
+  })
+
+  it('gives up waiting after the timeout', async () => {
+    fs.mkdirSync(path.dirname(file), { recursive: true })
+    fs.writeFileSync(file, `${process.pid}`)
+
+    await expect(
+      withLock(file, async () => 'done', { timeout: 10, poll: 5 })
+    ).rejects.toThrow(`Timed out waiting for the lock ${file}`)
+    expect(core.info).toHaveBeenCalledTimes(1)
+  })
+})
@@ -0,0 +1,176 @@
+/**
+ * Unit tests for src/logger.ts
+ */
+
+import * as log from '../src/logger'
+
+describe('logger', () => {
+  let stdout: jest.SpyInstance
+  let stderr: jest.SpyInstance
+
+  beforeEach(() => {
+    stdout = jest.spyOn(process.stdout, 'write').mockReturnValue(true)
+    stderr = jest.spyOn(process.stderr, 'write').mockReturnValue(true)
+  })
+
+  afterEach(() => {
+    log.setLogStream('stdout')
+    stdout.mockRestore()
+    stderr.mockRestore()
+  })
+
+  function written(spy: jest.SpyInstance): string {
+    return spy.mock.calls.map(call => String(call[0])).join('')
+  }
+
+  it('writes info to stdout by default', () => {
+    log.info('hello')
+    expect(written(stdout)).toContain('hello')
+    expect(written(stderr)).toBe('')
+  })
+
+  it('routes info to stderr when configured', () => {
+    log.setLogStream('stderr')
+    log.info('hello')
+    expect(written(stderr)).toContain('hello')
+    expect(written(stdout)).toBe('')
+  })
+
+  it('keeps annotations on stdout regardless of the stream', () => {
+    log.setLogStream('stderr')
+    log.warning('careful')
+    expect(written(stdout)).toContain('::warning::careful')
+    expect(written(stderr)).toBe('')
+  })
+
+  it('rejects unknown streams', () => {
+    expect(() => log.setLogStream('file')).toThrow(/Invalid log-stream/)
+    expect(log.getLogStream()).toBe('stdout')
+  })
+})
+
+describe('quiet', () => {
+  let stdout: jest.SpyInstance
+
+  beforeEach(() => {
+    stdout = jest.spyOn(process.stdout, 'write').mockReturnValue(true)
+  })
+
+  afterEach(() => {
+    log.setQuiet('false')
+    stdout.mockRestore()
+  })
+
+  function written(): string {
+    return stdout.mock.calls.map(call => String(call[0])).join('')
+  }
+
+  it('annotates advisories and warnings by default', () => {
+    log.advisory('No gop-version specified')
+    log.warning('Using the fallback-version')
+    expect(written()).toContain('::warning::No gop-version specified')
+    expect(written()).toContain('::warning::Using the fallback-version')
+  })
+
+  it('downgrades only advisories when quiet', () => {
+    log.setQuiet('true')
+    log.advisory('No gop-version specified')
+    log.warning('Using the fallback-version')
+    expect(written()).toContain('No gop-version specified')
+    expect(written()).not.toContain('::warning::No gop-version specified')
+    expect(written()).toContain('::warning::Using the fallback-version')
+  })
+
+  it('downgrades every warning when fully quiet', () => {
+    log.setQuiet('all')
+    log.advisory('No gop-version specified')
+    log.warning('Using the fallback-version')
+    expect(written()).toContain('Using the fallback-version')
+    expect(written()).not.toContain('::warning::')
+  })
+
+  it('rejects unknown levels', () => {
+    expect(() => log.setQuiet('yes')).toThrow(
+      "Invalid quiet 'yes', expected true, false or all"
+    )
+    expect(log.getQuiet()).toBe('off')
+  })
+})
+
+describe('debug', () => {
+  let stdout: jest.SpyInstance
+
+  beforeEach(() => {
+    stdout = jest.spyOn(process.stdout, 'write').mockReturnValue(true)
+  })
+
+  afterEach(() => {
+    log.setDebug(false)
+    delete process.env['RUNNER_DEBUG']
+    stdout.mockRestore()
+  })
+
+  function written(): string {
+    return stdout.mock.calls.map(call => String(call[0])).join('')
+  }
+
+  it('only emits ::debug:: lines by default, which GitHub hides', () => {
+    log.debug('hidden')
+    expect(written()).toContain('::debug::hidden')
+    expect(written()).not.toContain('##[debug]')
+  })
+
+  it('emits ::debug:: lines with step debug logging', () => {
+    process.env['RUNNER_DEBUG'] = '1'
+    log.debug('Selected version', { version: '1.2.0' })
+    expect(written()).toContain('::debug::Selected version {"version":"1.2.0"}')
+  })
+
+  it('writes visible debug lines when enabled by the input', () => {
+    log.setDebug(true)
+    log.debug('Matched versions', { matched: ['1.2.0'] })
+    expect(written()).toContain(
+      '##[debug]Matched versions {"matched":["1.2.0"]}'
+    )
+    expect(written()).not.toContain('::debug::')
+  })
+})
+
+describe('group', () => {
+  let stdout: jest.SpyInstance
+
+  beforeEach(() => {
+    stdout = jest.spyOn(process.stdout, 'write').mockReturnValue(true)
+  })
+
+  afterEach(() => {
+    stdout.mockRestore()
+  })
+
+  function written(): string {
+    return stdout.mock.calls.map(call => String(call[0])).join('')
+  }
+
+  it('wraps the output of fn in a group', () => {
+    expect(log.group('Cloning gop', () => 'gop')).toBe('gop')
+    expect(written()).toMatch(/::group::Cloning gop\s+::endgroup::/)
+  })
+
+  it('closes the group when fn throws', () => {
+    expect(() =>
+      log.group('Verifying gop', () => {
+        throw new Error('version mismatch')
+      })
+    ).toThrow('version mismatch')
+    expect(written()).toContain('::endgroup::')
+  })
+
+  it('closes the group when an async fn rejects', async () => {
+    await expect(
+      log.groupAsync('Building gop', async () => {
+        throw new Error('build failed')
+      })
+    ).rejects.toThrow('build failed')
+    expect(written()).toMatch(/::group::Building gop\s+::endgroup::/)
+  })
+})
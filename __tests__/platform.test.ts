@@ -0,0 +1,131 @@
+/**
+ * Unit tests for src/platform.ts
+ */
+
+import {
+  detectPlatform,
+  executableName,
+  floorSubject,
+  normalizeGoarch,
+  OsInfo,
+  osBelowFloor,
+  parseOsRelease,
+  pathDelimiter
+} from '../src/platform'
+
+describe('parseOsRelease', () => {
+  it('parses the ID and VERSION_ID fields', () => {
+    const contents = [
+      'PRETTY_NAME="Ubuntu 22.04.3 LTS"',
+      'NAME="Ubuntu"',
+      'VERSION_ID="22.04"',
+      'VERSION="22.04.3 LTS (Jammy Jellyfish)"',
+      'ID=ubuntu',
+      'ID_LIKE=debian',
+      ''
+    ].join('\n')
+    expect(parseOsRelease(contents)).toEqual({ id: 'ubuntu', version: '22.04' })
+  })
+
+  it('returns empty fields when they are missing', () => {
+    expect(parseOsRelease('NAME=Linux\n')).toEqual({ id: '', version: '' })
+  })
+})
+
+describe('floorSubject', () => {
+  const ubuntu = { id: 'ubuntu', version: '22.04' }
+
+  it('checks the kernel on Linux', () => {
+    expect(floorSubject(ubuntu, 'linux', () => '5.15.0-1057-azure')).toEqual({
+      id: 'linux',
+      version: '5.15.0-1057-azure'
+    })
+    expect(floorSubject(null, 'linux', () => '3.2.0')).toEqual({
+      id: 'linux',
+      version: '3.2.0'
+    })
+  })
+
+  it('checks the detected OS elsewhere', () => {
+    const macos = { id: 'macos', version: '14.1' }
+    expect(floorSubject(macos, 'darwin', () => '23.1.0')).toBe(macos)
+    expect(floorSubject(null, 'win32', () => '10.0.22631')).toBeNull()
+  })
+})
+
+describe('osBelowFloor', () => {
+  it('warns for an OS older than the go of the build supports', () => {
+    expect(osBelowFloor({ id: 'macos', version: '10.15.7' }, 'go1.23.4')).toBe(
+      '11'
+    )
+    expect(osBelowFloor({ id: 'macos', version: '10.14.6' }, 'go1.21.0')).toBe(
+      '10.15'
+    )
+  })
+
+  it('compares Linux kernels against the go of the build', () => {
+    const kernel = (version: string): OsInfo => ({ id: 'linux', version })
+    expect(osBelowFloor(kernel('2.6.32-754.el6.x86_64'), 'go1.24.1')).toBe(
+      '3.2'
+    )
+    expect(osBelowFloor(kernel('3.10.0-1160.el7.x86_64'), 'go1.24.1')).toBe(
+      ''
+    )
+    expect(osBelowFloor(kernel('6.8.0-1017-azure'), 'go1.25.0')).toBe('')
+    expect(osBelowFloor(kernel('2.6.32-754.el6.x86_64'), 'go1.23.4')).toBe('')
+  })
+
+  it('accepts an OS at or above the floor', () => {
+    expect(osBelowFloor({ id: 'macos', version: '11.7' }, 'go1.23.4')).toBe('')
+    expect(osBelowFloor({ id: 'macos', version: '10.14' }, 'go1.20.5')).toBe('')
+    expect(osBelowFloor({ id: 'macos', version: '14.1' }, 'go1.25.0')).toBe('')
+  })
+
+  it('ignores unknown OSes and go versions', () => {
+    expect(osBelowFloor({ id: 'ubuntu', version: '18.04' }, 'go1.23.4')).toBe(
+      ''
+    )
+    expect(osBelowFloor({ id: 'arch', version: '' }, 'go1.23.4')).toBe('')
+    expect(osBelowFloor({ id: 'macos', version: '10.13' }, '')).toBe('')
+  })
+})
+
+describe('executableName', () => {
+  it('appends .exe on Windows only', () => {
+    expect(executableName('gop', 'win32')).toBe('gop.exe')
+    expect(executableName('gop', 'linux')).toBe('gop')
+    expect(executableName('gop', 'darwin')).toBe('gop')
+  })
+})
+
+describe('pathDelimiter', () => {
+  it('uses ; on Windows and : elsewhere', () => {
+    expect(pathDelimiter('win32')).toBe(';')
+    expect(pathDelimiter('linux')).toBe(':')
+  })
+})
+
+describe('detectPlatform', () => {
+  it('maps common arch aliases to GOARCH', () => {
+    expect(normalizeGoarch('amd64')).toBe('amd64')
+    expect(normalizeGoarch('x86_64')).toBe('amd64')
+    expect(normalizeGoarch('X64')).toBe('amd64')
+    expect(normalizeGoarch('arm64')).toBe('arm64')
+    expect(normalizeGoarch('aarch64')).toBe('arm64')
+    expect(normalizeGoarch('i686')).toBe('386')
+    expect(normalizeGoarch('ppc64')).toBe('ppc64')
+    expect(normalizeGoarch('ppc64le')).toBe('ppc64le')
+    expect(normalizeGoarch('mips64')).toBe('mips64')
+  })
+
+  it('describes the host in Go terms', () => {
+    expect(detectPlatform('linux', 'arm64')).toEqual({
+      goos: 'linux',
+      goarch: 'arm64'
+    })
+    expect(detectPlatform('win32', 'x64')).toEqual({
+      goos: 'windows',
+      goarch: 'amd64'
+    })
+  })
+})
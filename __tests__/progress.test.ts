@@ -0,0 +1,57 @@
+/**
+ * Unit tests for src/progress.ts
+ */
+
+import { progressCounter, progressReader } from '../src/progress'
+
+describe('progressCounter', () => {
+  it('reports every step percent of the total', () => {
+    const reports: string[] = []
+    const counter = progressCounter('Downloading', 1000, 25, m => {
+      reports.push(m)
+    })
+
+    for (let i = 0; i < 10; i++) {
+      counter.add(100)
+    }
+    counter.done()
+
+    expect(reports.map(r => r.replace(/ \(.*/, ''))).toEqual([
+      'Downloading: 25%',
+      'Downloading: 50%',
+      'Downloading: 75%',
+      'Downloading: 100%'
+    ])
+  })
+
+  it('only reports the size at the end without a total', () => {
+    const reports: string[] = []
+    const counter = progressCounter('Downloading', 0, 5, m => {
+      reports.push(m)
+    })
+
+    counter.add(1024 * 1024)
+    counter.add(1024 * 1024)
+    expect(reports).toEqual([])
+
+    counter.done()
+    expect(reports).toEqual(['Downloading: 2.0 MiB'])
+  })
+})
+
+describe('progressReader', () => {
+  it('reads the whole body while reporting progress', async () => {
+    const reports: string[] = []
+    const body = Buffer.alloc(2048, 'a')
+    const res = new Response(body, {
+      headers: { 'content-length': `${body.length}` }
+    })
+
+    const read = await progressReader(res, 'Downloading', 5, m => {
+      reports.push(m)
+    })
+
+    expect(read.equals(body)).toBe(true)
+    expect(reports[reports.length - 1]).toMatch(/^Downloading: 100% /)
+  })
+})
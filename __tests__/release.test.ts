@@ -0,0 +1,189 @@
+/**
+ * Unit tests for src/release.ts
+ */
+
+import * as core from '@actions/core'
+import { execSync } from 'child_process'
+import crypto from 'crypto'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import {
+  downloadRelease,
+  findGopDir,
+  findReleaseAsset,
+  findReleaseRoot,
+  GOPLUS_RELEASES_API,
+  ReleaseAsset
+} from '../src/release'
+
+const asset = (name: string): ReleaseAsset => ({
+  name,
+  browser_download_url: `https://example.com/${name}`
+})
+
+describe('findReleaseAsset', () => {
+  const assets = [
+    asset('checksums.txt'),
+    asset('gop_v1.2.0_darwin_arm64.tar.gz'),
+    asset('gop_v1.2.0_linux_amd64.tar.gz'),
+    asset('gop_v1.2.0_windows_amd64.zip')
+  ]
+
+  it('matches the archive for the platform', () => {
+    expect(findReleaseAsset(assets, 'linux', 'amd64')?.name).toBe(
+      'gop_v1.2.0_linux_amd64.tar.gz'
+    )
+    expect(findReleaseAsset(assets, 'windows', 'amd64')?.name).toBe(
+      'gop_v1.2.0_windows_amd64.zip'
+    )
+  })
+
+  it('returns undefined for an unpublished platform', () => {
+    expect(findReleaseAsset(assets, 'linux', 'riscv64')).toBeUndefined()
+  })
+})
+
+describe('release downloads', () => {
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    jest.spyOn(core, 'info').mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    jest.restoreAllMocks()
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('finds the gop binary in a nested directory', () => {
+    fs.mkdirSync(path.join(tmpDir, 'gop', 'bin'), { recursive: true })
+    fs.writeFileSync(path.join(tmpDir, 'gop', 'README.md'), '')
+    fs.writeFileSync(path.join(tmpDir, 'gop', 'bin', 'gop'), '')
+
+    expect(findGopDir(tmpDir)).toBe(path.join(tmpDir, 'gop', 'bin'))
+  })
+
+  it('finds the gop root holding the binaries', () => {
+    const root = path.join(tmpDir, 'gop')
+    fs.mkdirSync(path.join(root, 'bin'), { recursive: true })
+    expect(findReleaseRoot(path.join(root, 'bin'), tmpDir)).toBeNull()
+
+    fs.writeFileSync(path.join(root, 'go.mod'), 'module github.com/goplus/gop')
+    expect(findReleaseRoot(path.join(root, 'bin'), tmpDir)).toBe(root)
+  })
+
+  it('returns null when the release does not exist', async () => {
+    const fetchMock = jest
+      .spyOn(global, 'fetch')
+      .mockResolvedValue(new Response('Not Found', { status: 404 }))
+
+    const binDir = path.join(tmpDir, 'bin')
+    expect(
+      await downloadRelease('9.9.9', 'linux', 'amd64', { binDir })
+    ).toBeNull()
+    expect(fetchMock.mock.calls[0][0]).toBe(
+      `${GOPLUS_RELEASES_API}/tags/v9.9.9`
+    )
+    expect(fs.existsSync(binDir)).toBe(false)
+  })
+
+  it('queries the releases API of a custom GitHub instance', async () => {
+    const fetchMock = jest
+      .spyOn(global, 'fetch')
+      .mockResolvedValue(new Response('Not Found', { status: 404 }))
+
+    await downloadRelease('1.2.0', 'linux', 'amd64', {
+      binDir: path.join(tmpDir, 'bin'),
+      apiUrl: 'https://ghes.example.com/api/v3/repos/goplus/gop/releases'
+    })
+
+    expect(fetchMock.mock.calls[0][0]).toBe(
+      'https://ghes.example.com/api/v3/repos/goplus/gop/releases/tags/v1.2.0'
+    )
+  })
+
+  it('installs the binaries of the platform archive', async () => {
+    const name = 'gop_v1.2.0_linux_amd64.tar.gz'
+    const staging = path.join(tmpDir, 'staging')
+    fs.mkdirSync(path.join(staging, 'gop', 'bin'), { recursive: true })
+    fs.writeFileSync(path.join(staging, 'gop', 'go.mod'), 'module gop')
+    fs.writeFileSync(path.join(staging, 'gop', 'bin', 'gop'), 'gop binary')
+    fs.writeFileSync(path.join(staging, 'gop', 'bin', 'gopfmt'), 'gopfmt')
+    execSync(`tar -czf "${path.join(tmpDir, name)}" -C "${staging}" gop`)
+    const archive = fs.readFileSync(path.join(tmpDir, name))
+    jest
+      .spyOn(global, 'fetch')
+      .mockResolvedValueOnce(Response.json({ assets: [asset(name)] }))
+      .mockResolvedValueOnce(new Response(archive))
+
+    const binDir = path.join(tmpDir, 'bin')
+    const rootDir = path.join(tmpDir, 'root')
+    expect(
+      await downloadRelease('1.2.0', 'linux', 'amd64', {
+        binDir,
+        rootDir,
+        token: 'secret'
+      })
+    ).toBe(binDir)
+    expect(fs.readdirSync(binDir).sort()).toEqual(['gop', 'gopfmt'])
+    expect(fs.readFileSync(path.join(binDir, 'gop')).toString()).toBe(
+      'gop binary'
+    )
+    expect(fs.readdirSync(rootDir).sort()).toEqual(['bin', 'go.mod'])
+  })
+
+  it('sends the token only to hosts of the GitHub instance', async () => {
+    const name = 'gop_v1.2.0_linux_amd64.tar.gz'
+    const staging = path.join(tmpDir, 'staging')
+    fs.mkdirSync(path.join(staging, 'bin'), { recursive: true })
+    fs.writeFileSync(path.join(staging, 'bin', 'gop'), 'gop binary')
+    execSync(`tar -czf "${path.join(tmpDir, name)}" -C "${staging}" bin`)
+    const archive = fs.readFileSync(path.join(tmpDir, name))
+    const sha = crypto.createHash('sha256').update(archive).digest('hex')
+    const download = 'https://github.com/goplus/gop/releases/download/v1.2.0'
+    const fetchMock = jest
+      .spyOn(global, 'fetch')
+      .mockResolvedValueOnce(
+        Response.json({
+          assets: [{ name, browser_download_url: `${download}/${name}` }]
+        })
+      )
+      .mockResolvedValueOnce(new Response(archive))
+      .mockResolvedValueOnce(new Response(`${sha}  ${name}\n`))
+
+    await downloadRelease('1.2.0', 'linux', 'amd64', {
+      binDir: path.join(tmpDir, 'bin'),
+      token: 'secret',
+      checksum: 'https://checksums.example.org/gop/SHA256SUMS'
+    })
+
+    const headers = fetchMock.mock.calls.map(
+      call => (call[1]?.headers || {}) as Record<string, string>
+    )
+    expect(fetchMock.mock.calls[2][0]).toBe(
+      'https://checksums.example.org/gop/SHA256SUMS'
+    )
+    expect(headers[0]['Authorization']).toBe('Bearer secret')
+    expect(headers[1]['Authorization']).toBe('Bearer secret')
+    expect(headers[2]['Authorization']).toBeUndefined()
+  })
+
+  it('aborts when the archive does not match the checksum', async () => {
+    const name = 'gop_v1.2.0_linux_amd64.tar.gz'
+    jest
+      .spyOn(global, 'fetch')
+      .mockResolvedValueOnce(Response.json({ assets: [asset(name)] }))
+      .mockResolvedValueOnce(new Response('tampered'))
+
+    const binDir = path.join(tmpDir, 'bin')
+    await expect(
+      downloadRelease('1.2.0', 'linux', 'amd64', {
+        binDir,
+        checksum: '0'.repeat(64)
+      })
+    ).rejects.toThrow(`Checksum mismatch for ${name}`)
+    expect(fs.existsSync(binDir)).toBe(false)
+  })
+})
@@ -0,0 +1,66 @@
+/**
+ * Unit tests for src/summary.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import {
+  InstallSummary,
+  summaryRows,
+  writeStepSummary
+} from '../src/summary'
+
+const summary: InstallSummary = {
+  version: '1.2.0',
+  verified: true,
+  source: 'release',
+  repo: 'https://github.com/goplus/gop.git',
+  ref: 'v1.2.0',
+  durationMs: 12345,
+  phasesMs: { fetch: 800, download: 4200 }
+}
+
+describe('summaryRows', () => {
+  it('formats the summary fields', () => {
+    expect(summaryRows(summary)).toEqual([
+      ['Version', '1.2.0'],
+      ['Verified', 'true'],
+      ['Source', 'release'],
+      ['Repository', 'https://github.com/goplus/gop.git'],
+      ['Ref', 'v1.2.0'],
+      ['Duration', '12.3s'],
+      ['Phases', 'fetch 0.8s, download 4.2s']
+    ])
+  })
+})
+
+describe('writeStepSummary', () => {
+  let tmpDir: string
+
+  beforeEach(() => {
+    tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+  })
+
+  afterEach(() => {
+    delete process.env['GITHUB_STEP_SUMMARY']
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  })
+
+  it('writes a table to the job summary', async () => {
+    const file = path.join(tmpDir, 'summary.md')
+    fs.writeFileSync(file, '')
+    process.env['GITHUB_STEP_SUMMARY'] = file
+
+    await writeStepSummary(summary)
+
+    const contents = fs.readFileSync(file).toString()
+    expect(contents).toContain('Setup Go+')
+    expect(contents).toContain('<td>download</td>')
+  })
+
+  it('does nothing without GITHUB_STEP_SUMMARY', async () => {
+    delete process.env['GITHUB_STEP_SUMMARY']
+    await expect(writeStepSummary(summary)).resolves.toBeUndefined()
+  })
+})
@@ -0,0 +1,68 @@
+/**
+ * Unit tests for src/trace.ts
+ */
+
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { Tracer } from '../src/trace'
+
+describe('Tracer', () => {
+  // A clock advancing by 10ms on every reading.
+  function fakeClock(): () => number {
+    let now = 1000
+    return () => {
+      now += 10
+      return now
+    }
+  }
+
+  it('writes a span for each executed phase', async () => {
+    const tracer = new Tracer(fakeClock())
+    const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+    try {
+      tracer.span('resolve', () => '1.1.7')
+      tracer.span('fetch', () => ['1.1.7'])
+      tracer.span('clone', () => '/tmp/gop')
+      await tracer.spanAsync('build', async () => '/tmp/bin')
+      tracer.span('verify', () => '1.1.7')
+      const tracePath = path.join(tmpDir, 'trace.json')
+      tracer.write(tracePath)
+
+      const trace = JSON.parse(fs.readFileSync(tracePath).toString())
+      expect(
+        trace.traceEvents.map((e: { name: string }) => e.name)
+      ).toEqual(['resolve', 'fetch', 'clone', 'build', 'verify'])
+      for (const event of trace.traceEvents) {
+        expect(event.ph).toBe('X')
+        expect(event.dur).toBe(10000)
+        expect(event.ts).toBeGreaterThan(0)
+      }
+    } finally {
+      fs.rmSync(tmpDir, { recursive: true, force: true })
+    }
+  })
+
+  it('records a span for a failed phase', () => {
+    const tracer = new Tracer(fakeClock())
+    expect(() =>
+      tracer.span('clone', () => {
+        throw new Error('clone failed')
+      })
+    ).toThrow('clone failed')
+    expect(tracer.getSpans()).toEqual([
+      { name: 'clone', start: 1010, end: 1020 }
+    ])
+  })
+
+  it('reports each span as it ends and totals them by name', () => {
+    const ended: string[] = []
+    const tracer = new Tracer(fakeClock(), s => ended.push(s.name))
+
+    tracer.span('fetch', () => [])
+    tracer.span('verify', () => tracer.span('fetch', () => []))
+
+    expect(ended).toEqual(['fetch', 'fetch', 'verify'])
+    expect(tracer.totals()).toEqual({ fetch: 20, verify: 30 })
+  })
+})
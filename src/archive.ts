@@ -0,0 +1,140 @@
+/**
+ * Fetches and extracts gop source archives, like a tarball pre-staged on the
+ * runner and given by gop-archive, so that gop can be built without git.
+ */
+import { execFileSync } from 'child_process'
+import fs from 'fs'
+import path from 'path'
+import { fetchWithRetry } from './http'
+import * as log from './logger'
+import { progressReader } from './progress'
+
+export type ArchiveType = 'tar.gz' | 'zip'
+
+// Returns the type of the archive named name, from its extension.
+export function archiveType(name: string): ArchiveType {
+  if (/\.(tar\.gz|tgz)$/i.test(name)) {
+    return 'tar.gz'
+  }
+  if (/\.zip$/i.test(name)) {
+    return 'zip'
+  }
+  throw new Error(
+    `Unsupported archive ${name}, expected a .tar.gz, .tgz or .zip file`
+  )
+}
+
+/**
+ * Returns the path the archive entry name is extracted to under dest. Entries
+ * escaping dest, like ../../etc/passwd, /etc/passwd or C:\Windows, are
+ * rejected so that a malicious archive cannot write outside of it (zip-slip).
+ * Every extraction checks all entries with it before extracting any.
+ * @returns {string} The absolute path of the entry.
+ */
+export function safeExtractPath(dest: string, name: string): string {
+  // Archives made on Windows may separate with backslashes, which extracting
+  // there follows.
+  const entry = name.replace(/\\/g, '/')
+  const root = path.resolve(dest)
+  const target = path.resolve(root, entry)
+  if (
+    entry.startsWith('/') ||
+    /^[a-zA-Z]:/.test(entry) ||
+    entry.includes('\0') ||
+    (target !== root && !target.startsWith(root + path.sep))
+  ) {
+    throw new Error(
+      `Refusing to extract archive entry '${name}', it escapes ${dest}`
+    )
+  }
+  return target
+}
+
+// GNU tar on Linux cannot read zip files, the bsdtar of Windows and macOS can.
+function useUnzip(archive: string, platform: NodeJS.Platform): boolean {
+  return archiveType(archive) === 'zip' && platform === 'linux'
+}
+
+// Lists the entry names of the archive, without extracting anything.
+export function listArchive(
+  archive: string,
+  platform: NodeJS.Platform = process.platform
+): string[] {
+  const out = useUnzip(archive, platform)
+    ? execFileSync('unzip', ['-Z1', archive])
+    : execFileSync('tar', ['-tf', archive])
+  return out
+    .toString()
+    .split(/\r?\n/)
+    .filter(name => name)
+}
+
+/**
+ * Extracts the archive to dest, after checking that none of its entries
+ * escapes dest.
+ */
+export function extractArchive(
+  archive: string,
+  dest: string,
+  list: (archive: string) => string[] = listArchive
+): void {
+  for (const name of list(archive)) {
+    safeExtractPath(dest, name)
+  }
+  fs.mkdirSync(dest, { recursive: true })
+  if (useUnzip(archive, process.platform)) {
+    execFileSync('unzip', ['-q', archive, '-d', dest], { stdio: 'inherit' })
+  } else {
+    execFileSync('tar', ['-xf', archive, '-C', dest], { stdio: 'inherit' })
+  }
+}
+
+// Returns the root of the source tree extracted to dir, which source archives
+// like GitHub's usually wrap in a single directory such as gop-1.2.3.
+export function sourceRoot(dir: string): string {
+  const entries = fs.readdirSync(dir, { withFileTypes: true })
+  if (
+    entries.length === 1 &&
+    entries[0].isDirectory() &&
+    !fs.existsSync(path.join(dir, 'go.mod'))
+  ) {
+    return path.join(dir, entries[0].name)
+  }
+  return dir
+}
+
+/**
+ * Extracts the gop source archive at source, a local path or an https URL, to
+ * workDir, downloading it first if needed.
+ * @returns {Promise<string>} The root of the extracted source tree.
+ */
+export async function fetchSourceArchive(
+  source: string,
+  workDir: string
+): Promise<string> {
+  let archive = path.resolve(source)
+  if (/^[a-z]+:\/\//i.test(source)) {
+    const url = new URL(source)
+    if (url.protocol !== 'https:') {
+      throw new Error('gop-archive must be a local path or an https URL')
+    }
+    archive = path.join(workDir, path.basename(url.pathname))
+    archiveType(archive)
+    log.info(`Downloading ${source} ...`)
+    const res = await fetchWithRetry(source)
+    if (!res.ok) {
+      throw new Error(`Failed to download ${source}: HTTP ${res.status}`)
+    }
+    fs.writeFileSync(
+      archive,
+      await progressReader(res, `Downloading ${path.basename(archive)}`)
+    )
+  } else if (!fs.existsSync(archive)) {
+    throw new Error(`gop-archive ${archive} does not exist`)
+  }
+  archiveType(archive)
+  const dest = path.join(workDir, 'src')
+  log.info(`Extracting ${path.basename(archive)} to ${dest}`)
+  extractArchive(archive, dest)
+  return sourceRoot(dest)
+}
@@ -0,0 +1,76 @@
+import fs from 'fs'
+import path from 'path'
+import { GOP_BINARIES } from './cache'
+import * as log from './logger'
+import { executableName, pathDelimiter } from './platform'
+
+export interface AliasOptions {
+  force?: boolean
+  platform?: NodeJS.Platform
+}
+
+/**
+ * Creates additional names for the gop binary in binDir: symlinks on Unix and
+ * copies on Windows, where symlinks need extra privileges.
+ * @returns {string[]} The paths of the created aliases.
+ */
+export function createBinaryAliases(
+  binDir: string,
+  aliases: string[],
+  options: AliasOptions = {}
+): string[] {
+  const platform = options.platform || process.platform
+  const gopBin = path.join(binDir, executableName('gop', platform))
+  const created: string[] = []
+  for (const alias of aliases) {
+    if (!/^[\w.-]+$/.test(alias) || isGopBinary(alias)) {
+      throw new Error(`Invalid binary alias '${alias}'`)
+    }
+    const existing = findInPath(alias, platform, binDir)
+    if (existing && !options.force) {
+      throw new Error(
+        `Binary alias '${alias}' collides with ${existing}, set binary-alias-force to override`
+      )
+    }
+    const aliasPath = path.join(binDir, executableName(alias, platform))
+    fs.rmSync(aliasPath, { force: true })
+    if (platform === 'win32') {
+      fs.copyFileSync(gopBin, aliasPath)
+    } else {
+      fs.symlinkSync(gopBin, aliasPath)
+    }
+    log.info(`Created binary alias ${aliasPath} -> ${gopBin}`)
+    created.push(aliasPath)
+  }
+  return created
+}
+
+// Reports whether name is one of the binaries gop's make installs, like gopfmt
+// or gop.exe, which an alias would overwrite. Case is ignored for the file
+// systems of Windows and macOS.
+function isGopBinary(name: string): boolean {
+  return GOP_BINARIES.includes(name.replace(/\.exe$/i, '').toLowerCase())
+}
+
+// Returns the path of the executable name found first on PATH, skipping
+// excludeDir, or '' if there is none.
+export function findInPath(
+  name: string,
+  platform: NodeJS.Platform = process.platform,
+  excludeDir = ''
+): string {
+  const dirs = (process.env['PATH'] || '').split(pathDelimiter(platform))
+  for (const dir of dirs) {
+    if (
+      !dir ||
+      (excludeDir && path.resolve(dir) === path.resolve(excludeDir))
+    ) {
+      continue
+    }
+    const candidate = path.join(dir, executableName(name, platform))
+    if (fs.existsSync(candidate)) {
+      return candidate
+    }
+  }
+  return ''
+}
@@ -0,0 +1,291 @@
+/**
+ * A local cache of built gop binaries, so that runs on the same runner can
+ * skip cloning and building a version they already built, and of the refs
+ * listed by git ls-remote.
+ */
+import crypto from 'crypto'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { movePath } from './fsutil'
+import { copyGopRoot } from './goproot'
+import * as log from './logger'
+
+export interface CacheKeyOptions {
+  race?: boolean
+  tags?: string[]
+  // The repository built from, when not the upstream gop repo.
+  repo?: string
+  // The custom build command, if any.
+  command?: string
+  // Extra environment variables of the build, if any.
+  env?: Record<string, string>
+}
+
+export function cacheRoot(): string {
+  return path.join(os.homedir(), '.cache', 'setup-goplus')
+}
+
+// Returns the cache directory for a version, keyed by the source repo and the
+// build flags that change the produced binaries.
+export function binaryCacheDir(
+  version: string,
+  options: CacheKeyOptions = {},
+  root: string = cacheRoot()
+): string {
+  return path.join(root, binaryCacheKey(version, options))
+}
+
+// Returns the key of the binaries of version built with options, usable as a
+// file name.
+export function binaryCacheKey(
+  version: string,
+  options: CacheKeyOptions = {}
+): string {
+  let key = version
+  if (options.race) {
+    key += '-race'
+  }
+  if (options.tags && options.tags.length > 0) {
+    key += `-tags-${[...options.tags].sort().join('_')}`
+  }
+  if (options.repo) {
+    const hash = crypto.createHash('sha256').update(options.repo).digest('hex')
+    key += `-repo-${hash.slice(0, 12)}`
+  }
+  if (options.command) {
+    const hash = crypto
+      .createHash('sha256')
+      .update(options.command)
+      .digest('hex')
+    key += `-cmd-${hash.slice(0, 12)}`
+  }
+  const env = Object.entries(options.env || {})
+  if (env.length > 0) {
+    const vars = env.map(([k, v]) => `${k}=${v}`).sort()
+    const hash = crypto
+      .createHash('sha256')
+      .update(vars.join('\n'))
+      .digest('hex')
+    key += `-env-${hash.slice(0, 12)}`
+  }
+  return key.replace(/[^\w.+-]/g, '_')
+}
+
+// The commands gop's make installs. Other gop* files in a bin dir, like gopls
+// or a renamed old gop, are not ours to cache.
+export const GOP_BINARIES = ['gop', 'gopfmt']
+
+// Lists the gop binaries in binDir, e.g. gop and gopfmt.
+export function gopBinaries(binDir: string): string[] {
+  if (!fs.existsSync(binDir)) {
+    return []
+  }
+  return fs
+    .readdirSync(binDir)
+    .filter(name => GOP_BINARIES.includes(name.replace(/\.exe$/i, '')))
+    .filter(name => fs.statSync(path.join(binDir, name)).isFile())
+}
+
+// The directory of a cache holding the gop root of its binaries, which they
+// read the gop standard library from.
+const ROOT_DIR = 'root'
+
+/**
+ * Copies the cached binaries in cacheDir to binDir, and their gop root to
+ * rootDir if given. Binaries cached without their gop root are a miss then.
+ * @returns {boolean} Whether the cache was hit.
+ */
+export function restoreBinaries(
+  cacheDir: string,
+  binDir: string,
+  rootDir = ''
+): boolean {
+  const names = gopBinaries(cacheDir)
+  if (names.length === 0) {
+    log.info(`No cached gop binaries in ${cacheDir}`)
+    return false
+  }
+  const cachedRoot = path.join(cacheDir, ROOT_DIR)
+  if (rootDir && !fs.existsSync(cachedRoot)) {
+    log.info(`No gop root cached with the gop binaries in ${cacheDir}`)
+    return false
+  }
+  fs.mkdirSync(binDir, { recursive: true })
+  for (const name of names) {
+    fs.copyFileSync(path.join(cacheDir, name), path.join(binDir, name))
+    fs.chmodSync(path.join(binDir, name), 0o755)
+  }
+  if (rootDir) {
+    copyGopRoot(cachedRoot, rootDir)
+  }
+  log.info(`Restored ${names.join(', ')} from ${cacheDir}`)
+  return true
+}
+
+// Stores the gop binaries of binDir in cacheDir, with their gop root rootDir
+// if given. The cache is staged next to cacheDir and moved in place, so
+// readers never see a partial cache.
+export function saveBinaries(
+  binDir: string,
+  cacheDir: string,
+  rootDir = ''
+): void {
+  const names = gopBinaries(binDir)
+  if (names.length === 0) {
+    log.warning(`No gop binaries found in ${binDir} to cache`)
+    return
+  }
+  const staging = `${cacheDir}.tmp-${process.pid}`
+  fs.rmSync(staging, { recursive: true, force: true })
+  fs.mkdirSync(staging, { recursive: true })
+  for (const name of names) {
+    fs.copyFileSync(path.join(binDir, name), path.join(staging, name))
+  }
+  if (rootDir) {
+    copyGopRoot(rootDir, path.join(staging, ROOT_DIR))
+  }
+  fs.rmSync(cacheDir, { recursive: true, force: true })
+  movePath(staging, cacheDir)
+  log.info(`Cached ${names.join(', ')} in ${cacheDir}`)
+}
+
+// Describes the gop binaries in a cache-dir, a directory persisted by the
+// actions/cache step of the workflow.
+export interface CacheManifest {
+  // The gop-cache-key output the binaries were written with.
+  key: string
+  version: string
+  // The commit gop was built from, empty when it was not built from a clone.
+  commit: string
+  // The platform the binaries run on, like linux-amd64.
+  platform: string
+}
+
+const MANIFEST_FILE = 'manifest.json'
+
+// Returns the key to persist the binaries of version for platform with
+// actions/cache, e.g. setup-goplus-gop-1.2.0-linux-amd64.
+export function cacheDirKey(
+  version: string,
+  platform: string,
+  options: CacheKeyOptions = {}
+): string {
+  return `setup-goplus-gop-${binaryCacheKey(version, options)}-${platform}`
+}
+
+/**
+ * Reads the manifest of the gop binaries in the cache-dir dir.
+ * @returns {CacheManifest | null} The manifest, or null if dir has none.
+ */
+export function readCacheManifest(dir: string): CacheManifest | null {
+  try {
+    const manifest = JSON.parse(
+      fs.readFileSync(path.join(dir, MANIFEST_FILE)).toString()
+    )
+    return typeof manifest?.key === 'string' ? manifest : null
+  } catch (error) {
+    return null
+  }
+}
+
+// Writes the gop binaries of binDir, their gop root rootDir if given and
+// their manifest to the cache-dir dir. The manifest is written last, so that
+// it only ever describes complete binaries.
+export function writeCacheDir(
+  binDir: string,
+  dir: string,
+  manifest: CacheManifest,
+  rootDir = ''
+): void {
+  const names = gopBinaries(binDir)
+  if (names.length === 0) {
+    log.warning(`No gop binaries found in ${binDir} to write to ${dir}`)
+    return
+  }
+  fs.mkdirSync(dir, { recursive: true })
+  const manifestPath = path.join(dir, MANIFEST_FILE)
+  fs.rmSync(manifestPath, { force: true })
+  for (const name of names) {
+    fs.copyFileSync(path.join(binDir, name), path.join(dir, name))
+  }
+  if (rootDir) {
+    copyGopRoot(rootDir, path.join(dir, ROOT_DIR))
+  }
+  const tmp = `${manifestPath}.tmp-${process.pid}`
+  fs.writeFileSync(tmp, JSON.stringify(manifest, null, 2))
+  fs.renameSync(tmp, manifestPath)
+  log.info(`Wrote ${names.join(', ')} and ${MANIFEST_FILE} to ${dir}`)
+}
+
+/**
+ * Copies the binaries in the cache-dir dir to binDir, and their gop root to
+ * rootDir if given, if its manifest has key.
+ * @returns {boolean} Whether the cache-dir held the binaries of key.
+ */
+export function restoreCacheDir(
+  dir: string,
+  binDir: string,
+  key: string,
+  rootDir = ''
+): boolean {
+  const manifest = readCacheManifest(dir)
+  if (manifest?.key !== key) {
+    log.info(`No gop binaries of ${key} in ${dir}`)
+    return false
+  }
+  return restoreBinaries(dir, binDir, rootDir)
+}
+
+// How long listed refs are reused before listing them again.
+export const REFS_TTL = 10 * 60 * 1000
+
+interface RefsEntry {
+  time: number
+  out: string
+}
+
+function refsCachePath(root: string): string {
+  return path.join(root, 'refs.json')
+}
+
+function readRefsFile(root: string): Record<string, RefsEntry> {
+  try {
+    return JSON.parse(fs.readFileSync(refsCachePath(root)).toString())
+  } catch (error) {
+    return {}
+  }
+}
+
+/**
+ * Returns the git ls-remote output cached for key, e.g. the repo URL and the
+ * kind of refs listed.
+ * @returns {string | null} The output, or null if missing or older than ttl.
+ */
+export function readRefsCache(
+  key: string,
+  ttl: number = REFS_TTL,
+  now: number = Date.now(),
+  root: string = cacheRoot()
+): string | null {
+  const entry = readRefsFile(root)[key]
+  if (!entry || now - entry.time > ttl) {
+    return null
+  }
+  return entry.out
+}
+
+export function writeRefsCache(
+  key: string,
+  out: string,
+  now: number = Date.now(),
+  root: string = cacheRoot()
+): void {
+  const entries = readRefsFile(root)
+  entries[key] = { time: now, out }
+  fs.mkdirSync(root, { recursive: true })
+  // Write and rename, so that concurrent jobs never read a partial file.
+  const tmp = `${refsCachePath(root)}.tmp-${process.pid}`
+  fs.writeFileSync(tmp, JSON.stringify(entries))
+  fs.renameSync(tmp, refsCachePath(root))
+}
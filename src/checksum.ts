@@ -0,0 +1,39 @@
+/**
+ * Integrity checks of downloaded gop archives.
+ */
+import crypto from 'crypto'
+import fs from 'fs'
+import path from 'path'
+
+export function sha256File(filePath: string): string {
+  return crypto
+    .createHash('sha256')
+    .update(fs.readFileSync(filePath))
+    .digest('hex')
+}
+
+// Throws if the SHA256 of the file at filePath is not expected.
+export function verifyChecksum(filePath: string, expected: string): void {
+  const want = expected.trim().toLowerCase()
+  if (!/^[0-9a-f]{64}$/.test(want)) {
+    throw new Error(`Invalid SHA256 checksum '${expected}'`)
+  }
+  const got = sha256File(filePath)
+  if (got !== want) {
+    throw new Error(
+      `Checksum mismatch for ${path.basename(filePath)}: expected ${want}, got ${got}`
+    )
+  }
+}
+
+// Finds the checksum of name in a checksums file as written by sha256sum,
+// one "<hash>  <name>" line per file.
+export function parseChecksums(contents: string, name: string): string {
+  for (const line of contents.split(/\r?\n/)) {
+    const match = line.trim().match(/^([0-9a-fA-F]{64})\s+\*?(.+)$/)
+    if (match && match[2] === name) {
+      return match[1].toLowerCase()
+    }
+  }
+  return ''
+}
@@ -0,0 +1,48 @@
+/**
+ * Helpers passing state to later steps of the job through the files GitHub
+ * names in GITHUB_ENV, GITHUB_OUTPUT and GITHUB_PATH.
+ */
+import * as core from '@actions/core'
+import * as log from './logger'
+import { pathDelimiter } from './platform'
+
+// Sets the environment variable name for later steps, like setOutput does for
+// outputs. Outside of a workflow, e.g. when running the action locally, only
+// this process sees the variable.
+export function setEnv(name: string, value: string): void {
+  if (!process.env['GITHUB_ENV']) {
+    log.warning(`GITHUB_ENV is not set, ${name} is only set for this process`)
+    process.env[name] = value
+    return
+  }
+  core.exportVariable(name, value)
+}
+
+// Sets the step output name. Outside of a workflow the value is only logged.
+export function setOutput(name: string, value: unknown): void {
+  if (!process.env['GITHUB_OUTPUT']) {
+    const text = typeof value === 'string' ? value : JSON.stringify(value)
+    log.warning(`GITHUB_OUTPUT is not set, skipped output ${name}=${text}`)
+    return
+  }
+  core.setOutput(name, value)
+}
+
+// Prepends dir to PATH for this process and later steps. Outside of a workflow
+// only this process sees it.
+export function addPath(
+  dir: string,
+  platform: NodeJS.Platform = process.platform
+): void {
+  if (!process.env['GITHUB_PATH']) {
+    log.warning(
+      `GITHUB_PATH is not set, ${dir} is only on PATH for this process`
+    )
+    const current = process.env['PATH']
+    process.env['PATH'] = current
+      ? `${dir}${pathDelimiter(platform)}${current}`
+      : dir
+    return
+  }
+  core.addPath(dir)
+}
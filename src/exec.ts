@@ -0,0 +1,306 @@
+/**
+ * Helpers for running the external commands the action depends on.
+ */
+import { ExecFileSyncOptions, execFileSync, spawn } from 'child_process'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import * as log from './logger'
+
+export interface TeeOptions {
+  cwd?: string
+  env?: NodeJS.ProcessEnv
+  // Kills the command after this many milliseconds, 0 for no limit.
+  timeout?: number
+}
+
+// Reports whether error is from a command killed for exceeding its timeout.
+export function isTimeout(error: unknown): boolean {
+  return (error as { code?: string } | null)?.code === 'ETIMEDOUT'
+}
+
+/**
+ * Runs command in a shell, streaming its stdout and stderr to the live log and
+ * to logPath. The log file is complete even if the command fails.
+ * @returns {Promise<void>} Resolves when the command exits successfully.
+ */
+export async function execTee(
+  command: string,
+  logPath: string,
+  options: TeeOptions = {}
+): Promise<void> {
+  fs.mkdirSync(path.dirname(path.resolve(logPath)), { recursive: true })
+  const fd = fs.openSync(logPath, 'w')
+  return new Promise<void>((resolve, reject) => {
+    const child = spawn(command, {
+      cwd: options.cwd,
+      env: options.env,
+      shell: true,
+      stdio: ['inherit', 'pipe', 'pipe']
+    })
+    let done = false
+    let timer: NodeJS.Timeout | undefined
+    // Output still buffered when the command times out is only shown live,
+    // the log file is already closed.
+    const write = (chunk: Buffer): void => {
+      if (!done) {
+        fs.writeSync(fd, chunk)
+      }
+    }
+    child.stdout.on('data', (chunk: Buffer) => {
+      process.stdout.write(chunk)
+      write(chunk)
+    })
+    child.stderr.on('data', (chunk: Buffer) => {
+      process.stderr.write(chunk)
+      write(chunk)
+    })
+    const finish = (error?: Error): void => {
+      if (done) {
+        return
+      }
+      done = true
+      clearTimeout(timer)
+      fs.closeSync(fd)
+      if (error) {
+        reject(error)
+      } else {
+        resolve()
+      }
+    }
+    if (options.timeout) {
+      timer = setTimeout(() => {
+        child.kill()
+        const error = new Error(
+          `Command timed out after ${options.timeout}ms: ${command}`
+        )
+        finish(Object.assign(error, { code: 'ETIMEDOUT' }))
+      }, options.timeout)
+    }
+    child.on('error', finish)
+    child.on('close', (code, signal) => {
+      if (code === 0) {
+        finish()
+      } else {
+        const status = signal ? `signal ${signal}` : `exit code ${code}`
+        finish(new Error(`Command failed with ${status}: ${command}`))
+      }
+    })
+  })
+}
+
+// Redacts credentials from a command line before it is logged, like the user
+// info of a URL or the value of an authorization header.
+export function redactCommand(command: string): string {
+  return command
+    .replace(/([a-z][a-z0-9+.-]*:\/\/)[^/@\s]+@/gi, '$1***@')
+    .replace(/(authorization:\s*(?:\w+\s+)?)[^\s"]+/gi, '$1***')
+}
+
+// Logs a command line and the directory it runs in when debug output is on,
+// so that a failure can be reproduced.
+export function logCommand(command: string, cwd?: string): void {
+  if (log.isDebug()) {
+    log.debug(`Running ${redactCommand(command)}`, {
+      cwd: cwd || process.cwd()
+    })
+  }
+}
+
+// Runs file with args like execFileSync, logging the full command line first
+// when debug output is on.
+export function runLogged(
+  file: string,
+  args: string[],
+  options: ExecFileSyncOptions = {}
+): Buffer {
+  logCommand([file, ...args].map(shellQuote).join(' '), options.cwd?.toString())
+  return execFileSync(file, args, options) as Buffer
+}
+
+// Run by node -e with the path to keep stderr in, the file and its args: runs
+// the file with its stderr both forwarded live and written to that path.
+const TEE_STDERR = `
+const { spawn } = require('child_process')
+const fs = require('fs')
+const [stderrPath, file, ...args] = process.argv.slice(1)
+const fd = fs.openSync(stderrPath, 'w')
+const child = spawn(file, args, { stdio: ['ignore', 'inherit', 'pipe'] })
+child.stderr.on('data', chunk => {
+  process.stderr.write(chunk)
+  fs.writeSync(fd, chunk)
+})
+process.on('SIGTERM', () => child.kill())
+child.on('error', error => {
+  fs.writeSync(fd, error.message)
+  process.exit(127)
+})
+child.on('close', code => process.exit(code ?? 1))
+`
+
+// Lines of a live stderr kept for the error message, the last ones say why.
+const STDERR_TAIL_LINES = 10
+
+/**
+ * Runs file with args like runLogged, forwarding its stderr to the log as it
+ * is written while keeping its last lines, which a failure is thrown with as
+ * the stderr of the error.
+ * @returns {Buffer} The stdout of the command.
+ */
+export function runTeeStderr(
+  file: string,
+  args: string[],
+  options: ExecFileSyncOptions = {}
+): Buffer {
+  logCommand([file, ...args].map(shellQuote).join(' '), options.cwd?.toString())
+  const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+  const stderrPath = path.join(tmpDir, 'stderr')
+  try {
+    return execFileSync(
+      process.execPath,
+      ['-e', TEE_STDERR, stderrPath, file, ...args],
+      { ...options, stdio: ['ignore', 'pipe', 'inherit'] }
+    ) as Buffer
+  } catch (error) {
+    const stderr = fs.existsSync(stderrPath)
+      ? fs.readFileSync(stderrPath).toString()
+      : ''
+    const tail = stderr
+      .split(/[\r\n]+/)
+      .filter(line => line.trim())
+      .slice(-STDERR_TAIL_LINES)
+      .join('\n')
+    throw Object.assign(error as Error, { stderr: tail })
+  } finally {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  }
+}
+
+export interface GitRetryOptions {
+  // Number of retries after the first attempt.
+  retries?: number
+  // Base delay of the exponential backoff, in milliseconds.
+  backoff?: number
+  // Kills an attempt after this many milliseconds, 0 for no limit.
+  timeout?: number
+  // Forwards stderr to the log as it is written, e.g. the progress of a
+  // clone, keeping its last lines for the error message.
+  liveStderr?: boolean
+  // Variables added to the environment of git, e.g. the config authenticating
+  // it, which are kept out of its command line.
+  env?: Record<string, string>
+  sleep?: (ms: number) => void
+}
+
+// Blocks the thread for ms milliseconds, for retrying synchronous commands.
+export function sleepSync(ms: number): void {
+  Atomics.wait(new Int32Array(new SharedArrayBuffer(4)), 0, 0, ms)
+}
+
+// Runs git with args in dir and the variables env added to its environment,
+// returning its stdout. Functions running git take one, defaulting to
+// runGitWithRetry, so that tests can stub git.
+export type GitRunner = (
+  args: string[],
+  dir?: string,
+  env?: Record<string, string>
+) => string
+
+/**
+ * Runs git with args in dir, retrying a non-zero exit with exponential
+ * backoff, e.g. after 1s, 2s and 4s, to ride out transient network errors.
+ * @returns {string} The stdout of the first successful attempt.
+ */
+export function runGitWithRetry(
+  args: string[],
+  dir?: string,
+  options: GitRetryOptions = {}
+): string {
+  const retries = options.retries ?? 3
+  const backoff = options.backoff ?? 1000
+  const wait = options.sleep || sleepSync
+  const command = redactCommand(`git ${args.join(' ')}`)
+  for (let attempt = 0; ; attempt++) {
+    try {
+      const run = options.liveStderr ? runTeeStderr : runLogged
+      return run('git', args, {
+        cwd: dir,
+        stdio: ['ignore', 'pipe', 'pipe'],
+        timeout: options.timeout || undefined,
+        env: options.env ? { ...process.env, ...options.env } : undefined
+      }).toString()
+    } catch (error) {
+      const stderr = `${(error as { stderr?: Buffer }).stderr || ''}`.trim()
+      const reason = isTimeout(error)
+        ? `timed out after ${options.timeout}ms`
+        : stderr || `${error}`
+      if (attempt >= retries) {
+        throw new Error(`${command} failed: ${reason}`)
+      }
+      const delay = backoff * 2 ** attempt
+      log.warning(
+        `${command} failed: ${reason}, retrying in ${delay / 1000}s (${attempt + 1}/${retries})`
+      )
+      wait(delay)
+    }
+  }
+}
+
+/**
+ * Splits command into arguments like a POSIX shell, honoring single quotes,
+ * double quotes and backslash escapes. Nothing is expanded.
+ * @returns {string[]} The arguments, empty for a blank command.
+ */
+export function splitCommand(command: string): string[] {
+  const args: string[] = []
+  let arg = ''
+  let inArg = false
+  let quote = ''
+  for (let i = 0; i < command.length; i++) {
+    const c = command[i]
+    if (quote === "'") {
+      if (c === "'") {
+        quote = ''
+      } else {
+        arg += c
+      }
+    } else if (c === '\\' && i + 1 < command.length) {
+      arg += command[++i]
+      inArg = true
+    } else if (quote === '"') {
+      if (c === '"') {
+        quote = ''
+      } else {
+        arg += c
+      }
+    } else if (c === "'" || c === '"') {
+      quote = c
+      inArg = true
+    } else if (/\s/.test(c)) {
+      if (inArg) {
+        args.push(arg)
+        arg = ''
+        inArg = false
+      }
+    } else {
+      arg += c
+      inArg = true
+    }
+  }
+  if (quote) {
+    throw new Error(`Unterminated ${quote} quote in command: ${command}`)
+  }
+  if (inArg) {
+    args.push(arg)
+  }
+  return args
+}
+
+// Quotes arg for passing to a shell if it contains characters the shell
+// would interpret.
+export function shellQuote(arg: string): string {
+  if (/^[\w@%+=:,./-]+$/.test(arg)) {
+    return arg
+  }
+  return `"${arg.replace(/(["\\$`])/g, '\\$1')}"`
+}
@@ -0,0 +1,85 @@
+/**
+ * File system helpers that behave on runners where HOME or the install
+ * directories are symlinks, possibly onto other file systems.
+ */
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+
+// Expands a leading ~ in dir to the home directory, as a shell would for
+// paths given in inputs. Other paths are returned unchanged.
+export function expandHome(dir: string, home: string = os.homedir()): string {
+  if (dir === '~') {
+    return home
+  }
+  if (dir.startsWith('~/') || dir.startsWith('~\\')) {
+    return path.join(home, dir.slice(2))
+  }
+  return dir
+}
+
+// Resolves symlinks in dir, or in its closest existing ancestor if dir does
+// not exist yet.
+export function resolveDir(dir: string): string {
+  const absolute = path.resolve(dir)
+  let existing = absolute
+  while (!fs.existsSync(existing) && path.dirname(existing) !== existing) {
+    existing = path.dirname(existing)
+  }
+  return path.join(fs.realpathSync(existing), path.relative(existing, absolute))
+}
+
+// Creates dir if missing, readable and executable by all like /usr/local/bin,
+// and throws a clear error unless it is writable, before anything is installed
+// to it.
+export function ensureWritableDir(dir: string): void {
+  try {
+    fs.mkdirSync(dir, { recursive: true, mode: 0o755 })
+    fs.accessSync(dir, fs.constants.W_OK)
+  } catch (error) {
+    throw new Error(`Unable to install to ${dir}, it is not writable: ${error}`)
+  }
+}
+
+/**
+ * Moves src to dest, falling back to copying and removing src when they are on
+ * different file systems and a rename fails with EXDEV.
+ */
+export function movePath(
+  src: string,
+  dest: string,
+  rename: (oldPath: string, newPath: string) => void = fs.renameSync
+): void {
+  try {
+    rename(src, dest)
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code !== 'EXDEV') {
+      throw error
+    }
+    fs.cpSync(src, dest, { recursive: true, verbatimSymlinks: true })
+    fs.rmSync(src, { recursive: true, force: true })
+  }
+}
+
+/**
+ * Makes file executable if it lacks the execute bits, as binaries may land
+ * without them on some file systems. Windows has no execute bits.
+ * @returns {boolean} Whether the execute bits had to be added.
+ */
+export function ensureExecutable(
+  file: string,
+  platform: NodeJS.Platform = process.platform
+): boolean {
+  if (platform === 'win32') {
+    return false
+  }
+  const mode = fs.statSync(file).mode
+  if ((mode & 0o111) !== 0) {
+    return false
+  }
+  fs.chmodSync(file, mode | 0o111)
+  if ((fs.statSync(file).mode & 0o111) === 0) {
+    throw new Error(`Unable to make ${file} executable`)
+  }
+  return true
+}
@@ -0,0 +1,64 @@
+/**
+ * URLs of the GitHub instance gop is installed from, github.com or a GitHub
+ * Enterprise Server mirroring goplus/gop.
+ */
+import { getInput } from './inputs'
+
+export const GITHUB_URL = 'https://github.com'
+
+/**
+ * Returns the URL of the GitHub instance from the github-server-url input,
+ * falling back to the GITHUB_SERVER_URL of the runner, then to github.com.
+ * @returns {string} The URL, without a trailing slash.
+ */
+export function githubServerUrl(
+  input: string = getInput('GITHUB_SERVER_URL'),
+  env: NodeJS.ProcessEnv = process.env
+): string {
+  const url = (input || env['GITHUB_SERVER_URL'] || GITHUB_URL).replace(
+    /\/+$/,
+    ''
+  )
+  let protocol = ''
+  try {
+    protocol = new URL(url).protocol
+  } catch (error) {
+    protocol = ''
+  }
+  if (protocol !== 'https:' && protocol !== 'http:') {
+    throw new Error(
+      `Invalid github-server-url '${url}', expected an http(s) URL`
+    )
+  }
+  return url
+}
+
+// Returns the REST API URL of a GitHub instance, /api/v3 on GHES.
+export function githubApiUrl(serverUrl: string): string {
+  return serverUrl === GITHUB_URL
+    ? 'https://api.github.com'
+    : `${serverUrl}/api/v3`
+}
+
+// Reports whether url is on the GitHub instance at serverUrl, its web or API
+// host, the only hosts the GitHub token may be sent to.
+export function isGitHubUrl(url: string, serverUrl: string): boolean {
+  try {
+    const { host } = new URL(url)
+    return (
+      host === new URL(serverUrl).host ||
+      host === new URL(githubApiUrl(serverUrl)).host
+    )
+  } catch (error) {
+    return false
+  }
+}
+
+// Returns the clone URL of goplus/gop on a GitHub instance.
+export function upstreamRepo(serverUrl: string): string {
+  return `${serverUrl}/goplus/gop.git`
+}
+
+export function releasesApiUrl(serverUrl: string): string {
+  return `${githubApiUrl(serverUrl)}/repos/goplus/gop/releases`
+}
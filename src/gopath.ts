@@ -0,0 +1,52 @@
+/**
+ * The GOPATH layout: the gop source linked to where tools resolving gop by
+ * its import path look for it.
+ */
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { setEnv } from './commands'
+import * as log from './logger'
+
+const GOPLUS_SRC_PATH = path.join('src', 'github.com', 'goplus', 'gop')
+
+export function defaultGopath(): string {
+  return process.env['GOPATH'] || path.join(os.homedir(), 'go')
+}
+
+// Removes the link at target left by a previous run. Anything else there, like
+// a real gop checkout on a self-hosted runner, is never deleted.
+function removeLink(target: string): void {
+  let stat: fs.Stats
+  try {
+    stat = fs.lstatSync(target)
+  } catch (error) {
+    return
+  }
+  // Junctions are reported as symbolic links too.
+  if (!stat.isSymbolicLink()) {
+    throw new Error(
+      `${target} already exists and is not a link, move it away or unset gopath-layout`
+    )
+  }
+  fs.unlinkSync(target)
+}
+
+/**
+ * Links the gop source into GOPATH/src/github.com/goplus/gop for tools that
+ * resolve gop by its source path, and exports GOPATH for later steps.
+ * @returns {string} The path of the source in the GOPATH layout.
+ */
+export function createGopathLayout(
+  gopDir: string,
+  gopath: string = defaultGopath()
+): string {
+  const target = path.join(gopath, GOPLUS_SRC_PATH)
+  fs.mkdirSync(path.dirname(target), { recursive: true })
+  removeLink(target)
+  // Junctions don't need extra privileges on Windows.
+  fs.symlinkSync(path.resolve(gopDir), target, 'junction')
+  log.info(`Linked gop source ${gopDir} to ${target}`)
+  setEnv('GOPATH', gopath)
+  return target
+}
@@ -0,0 +1,52 @@
+/**
+ * The gop root: the source tree gop was built in, or the tree of its release,
+ * which gop reads its standard library from. gop's make links the tree it is
+ * built in into gop as its default GOPROOT, so roots are kept apart from the
+ * work dirs removed as the action returns.
+ */
+import crypto from 'crypto'
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { movePath } from './fsutil'
+import * as log from './logger'
+
+// Returns the gop root of the gop installed to binDir.
+export function gopRootDir(
+  binDir: string,
+  home: string = os.homedir()
+): string {
+  const hash = crypto
+    .createHash('sha256')
+    .update(path.resolve(binDir))
+    .digest('hex')
+  return path.join(home, '.setup-goplus', 'roots', hash.slice(0, 16))
+}
+
+/**
+ * Moves the source tree src to rootDir, replacing the root of a previous
+ * install, so that gop is built where it stays.
+ * @returns {string} rootDir.
+ */
+export function moveToGopRoot(src: string, rootDir: string): string {
+  fs.rmSync(rootDir, { recursive: true, force: true })
+  fs.mkdirSync(path.dirname(rootDir), { recursive: true })
+  movePath(src, rootDir)
+  log.info(`Moved the gop source ${src} to the gop root ${rootDir}`)
+  return rootDir
+}
+
+// Copies the gop root src to dest without its git history. The copy is staged
+// next to dest and moved in place, so readers never see a partial root.
+export function copyGopRoot(src: string, dest: string): void {
+  const staging = `${dest}.tmp-${process.pid}`
+  fs.rmSync(staging, { recursive: true, force: true })
+  fs.mkdirSync(path.dirname(dest), { recursive: true })
+  fs.cpSync(src, staging, {
+    recursive: true,
+    verbatimSymlinks: true,
+    filter: file => path.basename(file) !== '.git'
+  })
+  fs.rmSync(dest, { recursive: true, force: true })
+  movePath(staging, dest)
+}
@@ -0,0 +1,186 @@
+/**
+ * HTTP helpers for talking to the GitHub API and downloading release assets.
+ */
+import { HttpClient } from '@actions/http-client'
+import { Readable } from 'stream'
+import * as log from './logger'
+
+export interface RetryOptions {
+  // Number of retries after the first attempt.
+  retries?: number
+  // Base delay of the exponential backoff, in milliseconds.
+  backoff?: number
+  // Longest Retry-After to wait for, in milliseconds. A rate limit lifting
+  // later fails the request instead of stalling the job.
+  maxRetryAfter?: number
+  sleep?: (ms: number) => Promise<void>
+}
+
+export const MAX_RETRY_AFTER = 60 * 1000
+
+export async function sleep(ms: number): Promise<void> {
+  return new Promise(resolve => setTimeout(resolve, ms))
+}
+
+/**
+ * Parses a Retry-After header, which is either a number of seconds or an
+ * HTTP-date.
+ * @returns {number | null} The delay in milliseconds, or null if invalid.
+ */
+export function parseRetryAfter(
+  value: string | null,
+  now: number = Date.now()
+): number | null {
+  if (!value) {
+    return null
+  }
+  const trimmed = value.trim()
+  if (/^\d+$/.test(trimmed)) {
+    return parseInt(trimmed, 10) * 1000
+  }
+  const date = Date.parse(trimmed)
+  if (isNaN(date)) {
+    return null
+  }
+  return Math.max(0, date - now)
+}
+
+const PROXY_VARS = ['HTTPS_PROXY', 'https_proxy', 'HTTP_PROXY', 'http_proxy']
+
+/**
+ * Returns the proxy to use for url from HTTPS_PROXY or HTTP_PROXY, matching
+ * the scheme of url, unless its host is excluded by NO_PROXY. Like Go's
+ * http.ProxyFromEnvironment, upper case variables take precedence.
+ * @returns {string} The proxy URL, or an empty string to connect directly.
+ */
+export function proxyForUrl(
+  url: string,
+  env: NodeJS.ProcessEnv = process.env
+): string {
+  const { protocol, hostname, port } = new URL(url)
+  const https = protocol === 'https:'
+  const effectivePort = port || (https ? '443' : '80')
+  const noProxy = env['NO_PROXY'] ?? env['no_proxy'] ?? ''
+  for (const entry of noProxy.split(',')) {
+    const [host, entryPort] = entry.trim().toLowerCase().split(':')
+    if (host === '*') {
+      return ''
+    }
+    if (!host || (entryPort && entryPort !== effectivePort)) {
+      continue
+    }
+    const domain = host.replace(/^\*?\./, '')
+    if (hostname === domain || hostname.endsWith(`.${domain}`)) {
+      return ''
+    }
+  }
+  const proxy = https
+    ? env['HTTPS_PROXY'] || env['https_proxy']
+    : env['HTTP_PROXY'] || env['http_proxy']
+  return proxy || ''
+}
+
+// Routes child processes, like git and the go build, and requests made by this
+// action through proxy, overriding the proxy of the environment.
+export function applyProxy(
+  proxy: string,
+  env: NodeJS.ProcessEnv = process.env
+): void {
+  const protocol = urlProtocol(proxy)
+  if (protocol !== 'http:' && protocol !== 'https:') {
+    // The proxy URL may hold credentials, so it is not echoed.
+    throw new Error('Invalid proxy, expected an http:// or https:// URL')
+  }
+  for (const name of PROXY_VARS) {
+    env[name] = proxy
+  }
+}
+
+function urlProtocol(url: string): string {
+  try {
+    return new URL(url).protocol
+  } catch (error) {
+    return ''
+  }
+}
+
+/**
+ * Fetches url through the proxy of the environment with @actions/http-client,
+ * as the fetch of Node 20 cannot use a proxy, and wraps its response like one
+ * of fetch.
+ * @returns {Promise<Response>} The response.
+ */
+export async function fetchViaProxy(
+  url: string,
+  init: RequestInit = {}
+): Promise<Response> {
+  const client = new HttpClient('setup-goplus')
+  const headers = Object.fromEntries(new Headers(init.headers).entries())
+  const res = await client.request(init.method || 'GET', url, null, headers)
+  const status = res.message.statusCode ?? 500
+  const responseHeaders = new Headers()
+  for (const [name, value] of Object.entries(res.message.headers)) {
+    for (const item of [value ?? []].flat()) {
+      responseHeaders.append(name, item)
+    }
+  }
+  // Responses to HEAD and statuses like 204 have no body.
+  const body =
+    init.method === 'HEAD' || status === 204 || status === 304
+      ? null
+      : (Readable.toWeb(res.message) as unknown as BodyInit)
+  return new Response(body, { status, headers: responseHeaders })
+}
+
+/**
+ * Fetches url, retrying network errors and server errors with exponential
+ * backoff. Rate limited responses (HTTP 429) are retried after the delay
+ * given by their Retry-After header, failing if it is over maxRetryAfter.
+ * @returns {Promise<Response>} The first successful or non-retryable response.
+ */
+export async function fetchWithRetry(
+  url: string,
+  init: RequestInit = {},
+  options: RetryOptions = {}
+): Promise<Response> {
+  const retries = options.retries ?? 3
+  const backoff = options.backoff ?? 1000
+  const wait = options.sleep || sleep
+  const maxRetryAfter = options.maxRetryAfter ?? MAX_RETRY_AFTER
+  for (let attempt = 0; ; attempt++) {
+    let delay = backoff * 2 ** attempt
+    let reason = ''
+    let res: Response | undefined
+    try {
+      res = proxyForUrl(url)
+        ? await fetchViaProxy(url, init)
+        : await fetch(url, init)
+    } catch (error) {
+      if (attempt >= retries) {
+        throw error
+      }
+      reason = `${error}`
+    }
+    if (res?.status === 429) {
+      const retryAfter = parseRetryAfter(res.headers.get('retry-after'))
+      if (retryAfter !== null) {
+        delay = retryAfter
+      }
+      reason = `rate limited (HTTP 429), retry after ${delay / 1000}s`
+      if (delay > maxRetryAfter) {
+        throw new Error(
+          `Request to ${url} was ${reason}, longer than the ${maxRetryAfter / 1000}s to wait`
+        )
+      }
+    } else if (res && res.status >= 500) {
+      reason = `HTTP ${res.status}`
+    }
+    if (res && (!reason || attempt >= retries)) {
+      return res
+    }
+    log.warning(
+      `Request to ${url} failed: ${reason}, retrying (${attempt + 1}/${retries})`
+    )
+    await wait(delay)
+  }
+}
@@ -0,0 +1,57 @@
+/**
+ * Helpers for reading the action inputs passed through the environment as
+ * `INPUT_<NAME>` by the composite step in action.yml.
+ */
+
+export function getInput(name: string): string {
+  return (process.env[`INPUT_${name}`] || '').trim()
+}
+
+export function getBooleanInput(name: string): boolean {
+  return getInput(name).toLowerCase() === 'true'
+}
+
+// Splits a comma or newline separated input into its non-empty items.
+export function getListInput(name: string): string[] {
+  return getInput(name)
+    .split(/[,\n]/)
+    .map(s => s.trim())
+    .filter(s => s)
+}
+
+const DURATION_UNITS: Record<string, number> = {
+  ms: 1,
+  s: 1000,
+  m: 60 * 1000,
+  h: 60 * 60 * 1000
+}
+
+// Parses a duration like 90s, 10m or 1h30m to milliseconds.
+export function parseDuration(value: string): number {
+  const parts = value.match(/\d+(\.\d+)?(ms|s|m|h)/g)
+  if (!parts || parts.join('') !== value) {
+    throw new Error(`Invalid duration '${value}', expected e.g. 90s or 10m`)
+  }
+  let ms = 0
+  for (const part of parts) {
+    const [, amount, unit] = part.match(/^([\d.]+)(\w+)$/) || []
+    ms += parseFloat(amount) * DURATION_UNITS[unit]
+  }
+  return ms
+}
+
+// Formats milliseconds in the largest unit that divides them, e.g. 10m.
+export function formatDuration(ms: number): string {
+  for (const unit of ['h', 'm', 's']) {
+    if (ms >= DURATION_UNITS[unit] && ms % DURATION_UNITS[unit] === 0) {
+      return `${ms / DURATION_UNITS[unit]}${unit}`
+    }
+  }
+  return `${ms}ms`
+}
+
+// Returns the duration of an input in milliseconds, 0 when not set.
+export function getDurationInput(name: string): number {
+  const value = getInput(name)
+  return value ? parseDuration(value) : 0
+}
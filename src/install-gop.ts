@@ -3,133 +3,2408 @@ import * as semver from 'semver'
 import fs from 'fs'
 import path from 'path'
 import os from 'os'
-import { execSync } from 'child_process'
+import { execFileSync, execSync } from 'child_process'
+import { fetchSourceArchive } from './archive'
+import { createBinaryAliases, findInPath } from './binary-alias'
+import {
+  binaryCacheDir,
+  cacheDirKey,
+  readRefsCache,
+  restoreBinaries,
+  restoreCacheDir,
+  saveBinaries,
+  writeCacheDir,
+  writeRefsCache
+} from './cache'
+import { addPath, setEnv, setOutput } from './commands'
+import {
+  execTee,
+  isTimeout,
+  logCommand,
+  GitRunner,
+  runGitWithRetry,
+  shellQuote,
+  sleepSync,
+  splitCommand
+} from './exec'
+import {
+  ensureExecutable,
+  ensureWritableDir,
+  expandHome,
+  resolveDir
+} from './fsutil'
+import { createGopathLayout } from './gopath'
+import { gopRootDir, moveToGopRoot } from './goproot'
+import {
+  GITHUB_URL,
+  githubServerUrl,
+  isGitHubUrl,
+  releasesApiUrl,
+  upstreamRepo
+} from './github'
+import { applyProxy } from './http'
+import {
+  formatDuration,
+  getBooleanInput,
+  getDurationInput,
+  getInput,
+  getListInput
+} from './inputs'
+import { lockPath, withLock } from './lock'
+import * as log from './logger'
+import {
+  executableName,
+  Platform,
+  detectPlatform,
+  normalizeGoarch,
+  isCrossBuild,
+  preflightOs
+} from './platform'
+import { downloadRelease } from './release'
+import {
+  InstallSource,
+  InstallSummary,
+  writeStepSummary
+} from './summary'
+import { Span, Tracer } from './trace'
 
 const GOPLUS_REPO = 'https://github.com/goplus/gop.git'
+const GOPLUS_MODULE = 'github.com/goplus/gop'
 
 /**
  * The main function for the action.
  * @returns {Promise<void>} Resolves when the action is complete.
  */
 export async function installGop(): Promise<void> {
+  clonedWorkDirs = []
+  const tracer = new Tracer(Date.now, logPhaseTime)
+  const start = Date.now()
   try {
-    const versionSpec = resolveVersionInput() || ''
-    const tagVersions = semver.rsort(fetchTags().filter(v => semver.valid(v)))
-    let version: string | null = null
-    if (!versionSpec || versionSpec === 'latest') {
-      version = tagVersions[0]
-      core.warning(`No gop-version specified, using latest version: ${version}`)
-    } else {
-      version = semver.maxSatisfying(tagVersions, versionSpec)
-      if (!version) {
-        core.warning(
-          `No gop-version found that satisfies '${versionSpec}', trying branches...`
+    log.setLogStream(getInput('LOG_STREAM') || 'stdout')
+    log.setDebug(getBooleanInput('DEBUG'))
+    log.setQuiet(getInput('QUIET').toLowerCase())
+    const command = getInput('COMMAND') || 'install'
+    if (command !== 'install' && command !== 'validate') {
+      throw new Error(
+        `Invalid command '${command}', expected install or validate`
+      )
+    }
+    const proxy = getInput('PROXY')
+    if (proxy) {
+      applyProxy(proxy)
+      log.info(`Using proxy ${maskUrl(proxy)}`)
+    }
+    // Check the tools up front, before any network work. Without a local
+    // source tree, git lists and clones the gop versions.
+    const sourceDir = getInput('GOP_SOURCE_DIR') || getInput('GOP_ARCHIVE')
+    if (!sourceDir) {
+      requireCommand(
+        'git',
+        'Install git on the runner, or build gop from a local source tree with gop-source-dir or gop-archive.'
+      )
+    }
+    const goBinary = getInput('GO_BINARY')
+    if ((sourceDir || command === 'validate') && !goBinary) {
+      requireGo()
+    }
+    const repo = gopRepo()
+    log.info(`Using gop repository ${maskUrl(repo)}`)
+    const token = getInput('TOKEN')
+    if (token) {
+      core.setSecret(token)
+    }
+    if (getBooleanInput('LIST_VERSIONS')) {
+      const versions = availableVersions(
+        tracer.span('fetch', () => fetchTags(repo)),
+        parseInt(getInput('LIST_LIMIT') || '0', 10),
+        getBooleanInput('INCLUDE_PRERELEASE')
+      )
+      log.info(`Available gop versions: ${versions.join(', ')}`)
+      setOutput('gop-available-versions', JSON.stringify(versions))
+      return
+    }
+    const ctx: InstallContext = {
+      command,
+      serverUrl: githubServerUrl(),
+      platform: targetPlatform(getInput('GOARCH')),
+      repo,
+      tracer,
+      buildOptions: {
+        race: getBooleanInput('BUILD_RACE'),
+        tags: getListInput('BUILD_TAGS'),
+        logPath: getInput('BUILD_LOG_PATH'),
+        timeout: getDurationInput('BUILD_TIMEOUT'),
+        command: getInput('BUILD_COMMAND') || undefined,
+        go: goBinary ? checkGoBinary(goBinary) : undefined,
+        env: parseBuildEnv(getInput('BUILD_ENV'))
+      }
+    }
+
+    // With gop-versions, every version is installed to its own directory and
+    // only the default one is added to PATH.
+    const specs = getListInput('GOP_VERSIONS')
+    const defaultSpec =
+      specs.length > 0 ? getInput('DEFAULT_VERSION') || specs[0] : undefined
+    if (specs.length > 0 && getInput('GOP_SOURCE_DIR')) {
+      throw new Error('gop-source-dir cannot be combined with gop-versions')
+    }
+    if (specs.length > 0 && getInput('GOP_ARCHIVE')) {
+      throw new Error('gop-archive cannot be combined with gop-versions')
+    }
+    if (defaultSpec !== undefined && !specs.includes(defaultSpec)) {
+      throw new Error(
+        `default-version '${defaultSpec}' is not one of gop-versions`
+      )
+    }
+    const gopVersions: Record<string, string> = {}
+    for (const spec of specs.filter(s => s !== defaultSpec)) {
+      const other = await installVersion(ctx, spec)
+      if (other) {
+        verifyInstall(tracer, other)
+        gopVersions[spec] = other.binDir
+      }
+    }
+
+    const installed = await installVersion(ctx, defaultSpec)
+    if (!installed) {
+      return
+    }
+    const { ref, binDir, source } = installed
+    setOutput('gop-install-source', source)
+    // Binaries restored from the cache or downloaded come without a source
+    // tree to tell the commit from.
+    setOutput('gop-commit', source === 'source' ? builtCommit(installed) : '')
+    let gopDir = installed.gopDir
+    addPath(binDir)
+    const { tools, optional } = expandToolPresets(
+      getListInput('INSTALL_TOOLS')
+    )
+    if (tools.length > 0) {
+      if (!gopDir) {
+        // Restored or downloaded binaries come without the source the tools
+        // are built from.
+        gopDir = cloneSource(ctx, ref)
+      }
+      const installedTools = tracer.span('tools', () =>
+        log.group(`Installing ${tools.join(', ')}`, () =>
+          installTools(gopDir, tools, ctx.buildOptions, binDir, optional)
+        )
+      )
+      setOutput('gop-tools-installed', JSON.stringify(installedTools))
+    }
+    setOutput('gop-bin-dir', binDir)
+    // Later steps run gop against the same standard library.
+    setOutput('gop-root', installed.rootDir)
+    if (installed.rootDir) {
+      setEnv('GOPROOT', installed.rootDir)
+    }
+    if (source !== 'source') {
+      // A build sets it from its source, other installs from their gop root.
+      const goMod = installed.rootDir ? readGoMod(installed.rootDir, ref) : ''
+      setOutput('min-go-version', goMod ? minGoVersion(goMod, ref) : '')
+    }
+    const aliases = getListInput('BINARY_ALIAS')
+    if (aliases.length > 0) {
+      createBinaryAliases(binDir, aliases, {
+        force: getBooleanInput('BINARY_ALIAS_FORCE')
+      })
+    }
+    if (getBooleanInput('RUN_GOP_TESTS')) {
+      if (gopDir) {
+        runGopTests(tracer, gopDir, ctx.buildOptions)
+      } else {
+        log.warning('Skipped running gop tests, gop was not built from source')
+      }
+    }
+    const verified = verifyInstall(tracer, installed)
+    setOutput('gop-version-verified', verified)
+    if (getBooleanInput('SMOKE_TEST')) {
+      tracer.span('verify', () =>
+        log.group('Running the gop smoke test', () => smokeTest(binDir))
+      )
+    }
+    const installedVersion = gopVersionWithRetry(binDir)
+    setOutput('gop-version', installedVersion)
+    setEnv('GOP_VERSION', installedVersion)
+    if (defaultSpec !== undefined) {
+      gopVersions[defaultSpec] = binDir
+      setOutput('gop-versions', JSON.stringify(gopVersions))
+    }
+    const summary: InstallSummary = {
+      version: installedVersion,
+      verified,
+      source,
+      repo: maskUrl(repo),
+      ref,
+      durationMs: Date.now() - start,
+      phasesMs: tracer.totals()
+    }
+    setOutput('gop-install-summary', JSON.stringify(summary))
+    await writeStepSummary(summary)
+  } catch (error) {
+    // Fail the workflow run if an error occurs
+    if (error instanceof Error) core.setFailed(error.message)
+  } finally {
+    removeWorkDirs()
+    const tracePath = getInput('TRACE_PATH')
+    if (tracePath) {
+      writeTrace(tracer, tracePath)
+    }
+  }
+}
+
+interface InstallContext {
+  command: string
+  // URL of the GitHub instance releases are downloaded from.
+  serverUrl: string
+  // The platform of prebuilt archives, the host's unless goarch is forced.
+  platform: Platform
+  repo: string
+  tracer: Tracer
+  buildOptions: BuildOptions
+}
+
+interface Installed {
+  // The selected version, empty when installing from a branch or commit.
+  version: string
+  ref: string
+  binDir: string
+  // The cloned source, empty when gop was restored from the cache or
+  // downloaded.
+  gopDir: string
+  // The gop root gop reads its standard library from, outliving the work
+  // dir. Empty when it is unknown, like for a gop found on PATH.
+  rootDir: string
+  source: InstallSource
+}
+
+/**
+ * Selects the gop version of versionSpec, or of the version inputs if
+ * undefined, and installs it from the cache, a prebuilt release or by building
+ * it from source. Versions of gop-versions, given by versionSpec, are
+ * installed to their own directory, others to the gop bin dir.
+ * @returns {Promise<Installed | null>} The install, or null if the command
+ * only validated the build.
+ */
+async function installVersion(
+  ctx: InstallContext,
+  versionSpec?: string
+): Promise<Installed | null> {
+  const { command, repo, tracer } = ctx
+  const sourceDir = getInput('GOP_SOURCE_DIR')
+  if (sourceDir) {
+    return installFromSource(ctx, resolveDir(sourceDir))
+  }
+  const archive = getInput('GOP_ARCHIVE')
+  if (archive) {
+    const workDir = workDirPath()
+    clonedWorkDirs.push(workDir)
+    const gopDir = await tracer.spanAsync('download', async () =>
+      fetchSourceArchive(archive, workDir)
+    )
+    return installFromSource(ctx, gopDir)
+  }
+  const { selection, fallbackUsed } = selectWithFallback(
+    fallback => selectGop(repo, tracer, fallback ?? versionSpec),
+    getInput('FALLBACK_VERSION')
+  )
+  const { version, ref } = selection
+  setOutput('gop-version-fallback-used', fallbackUsed)
+  const binDir =
+    versionSpec === undefined ? gopBinDir() : versionBinDir(version || ref)
+  if (command === 'install' && version && !getBooleanInput('FORCE')) {
+    const existing = findInstalledGop(version)
+    if (
+      existing &&
+      canReuseInstalled(
+        version,
+        ctx.buildOptions,
+        !!getInput('GOARCH'),
+        existing,
+        binDir
+      )
+    ) {
+      log.info(`gop ${version} is already installed in ${existing}, skipped`)
+      setOutput('cache-hit', false)
+      return {
+        version,
+        ref,
+        binDir: existing,
+        gopDir: '',
+        rootDir: '',
+        source: 'path'
+      }
+    }
+  }
+  ensureWritableDir(binDir)
+  // Parallel runs on one self-hosted runner take turns installing to the same
+  // bin dir.
+  return withLock(lockPath(binDir), async () =>
+    installLocked(ctx, selection, binDir)
+  )
+}
+
+// Installs the selected version to binDir, while holding its lock.
+async function installLocked(
+  ctx: InstallContext,
+  selection: Selection,
+  binDir: string
+): Promise<Installed | null> {
+  const { command, repo, tracer, buildOptions } = ctx
+  const { version, ref } = selection
+  const upstream = repo === upstreamRepo(ctx.serverUrl)
+  const { goos, goarch } = ctx.platform
+  const keyOptions = { ...buildOptions, repo: repo === GOPLUS_REPO ? '' : repo }
+  // Branches move, so only tagged versions are cached.
+  const cacheDir =
+    version && getInput('CACHE') !== 'false'
+      ? binaryCacheDir(version, keyOptions)
+      : ''
+  // The cache-dir is persisted by an actions/cache step of the workflow,
+  // keyed by the gop-cache-key output.
+  const persistDir =
+    version && getInput('CACHE_DIR') ? resolveDir(getInput('CACHE_DIR')) : ''
+  const persistKey = cacheDirKey(version, `${goos}-${goarch}`, keyOptions)
+  // The gop root gop is built in, restored with cached binaries or kept from
+  // the release tree.
+  const gopRoot = gopRootDir(binDir)
+  if (persistDir) {
+    setOutput('gop-cache-key', persistKey)
+    if (
+      command === 'install' &&
+      restoreCacheDir(persistDir, binDir, persistKey, gopRoot)
+    ) {
+      setOutput('cache-hit', true)
+      return {
+        version,
+        ref,
+        binDir,
+        gopDir: '',
+        rootDir: gopRoot,
+        source: 'cache'
+      }
+    }
+  }
+  const persist = (installed: Installed): Installed => {
+    if (persistDir) {
+      const manifest = {
+        key: persistKey,
+        version,
+        commit: installed.source === 'source' ? builtCommit(installed) : '',
+        platform: `${goos}-${goarch}`
+      }
+      writeCacheDir(binDir, persistDir, manifest, installed.rootDir)
+    }
+    return installed
+  }
+  // Runs installing to other bin dirs share the cache, they take turns
+  // reading and replacing it.
+  const withCacheLock = async <T>(fn: () => T): Promise<T> =>
+    withLock(lockPath(cacheDir), async () => fn())
+  const restored =
+    command === 'install' &&
+    !!cacheDir &&
+    (await withCacheLock(() => restoreBinaries(cacheDir, binDir, gopRoot)))
+  setOutput('cache-hit', restored)
+  if (restored) {
+    return persist({
+      version,
+      ref,
+      binDir,
+      gopDir: '',
+      rootDir: gopRoot,
+      source: 'cache'
+    })
+  }
+
+  const checksum = getInput('CHECKSUM')
+  const downloaded =
+    command === 'install' &&
+    upstream &&
+    usePrebuilt(version, buildOptions)
+      ? await tracer.spanAsync('download', async () =>
+          downloadRelease(version, goos, goarch, {
+            binDir,
+            rootDir: gopRoot,
+            token: getInput('TOKEN'),
+            checksum,
+            apiUrl: releasesApiUrl(ctx.serverUrl),
+            serverUrl: ctx.serverUrl
+          })
         )
-        const branchVersions = fetchBranches()
-        if (!branchVersions.includes(versionSpec)) {
-          throw new Error(
-            `No gop-version found that satisfies '${versionSpec}' in branches or tags`
-          )
-        }
-        version = ''
+      : null
+  if (command === 'install' && checksum && !downloaded) {
+    throw new Error(
+      `Unable to verify checksum, no prebuilt archive of gop ${ref} for ${goos}/${goarch}`
+    )
+  }
+  let gopDir = ''
+  let rootDir = downloaded && fs.existsSync(gopRoot) ? gopRoot : ''
+  let source: InstallSource = 'release'
+  if (!downloaded) {
+    if (!buildOptions.go) {
+      requireGo()
+    }
+    gopDir = cloneSource(ctx, ref)
+    if (command === 'install') {
+      // Build where the source stays, gop links it in as its default GOPROOT.
+      gopDir = moveToGopRoot(gopDir, gopRoot)
+      rootDir = gopDir
+    }
+    prepareSource(gopDir, ref, buildOptions)
+    if (command === 'validate') {
+      log.group(`Validating gop ${ref}`, () => validate(gopDir, buildOptions))
+      return null
+    }
+    await tracer.spanAsync('build', async () =>
+      log.groupAsync(`Building gop ${ref}`, async () =>
+        install(gopDir, buildOptions, binDir)
+      )
+    )
+    source = 'source'
+  }
+  if (cacheDir) {
+    await withCacheLock(() => saveBinaries(binDir, cacheDir, rootDir))
+  }
+  return persist({ version, ref, binDir, gopDir, rootDir, source })
+}
+
+/**
+ * Builds gop from the source tree in gopDir without git, for air-gapped
+ * runners: a gop-source-dir or an extracted gop-archive. The tree is not
+ * cached.
+ * @returns {Promise<Installed | null>} The install, or null if the command
+ * only validated the build.
+ */
+async function installFromSource(
+  ctx: InstallContext,
+  gopDir: string
+): Promise<Installed | null> {
+  validateSourceDir(gopDir)
+  ensureWritableDir(gopBinDir())
+  const version = sourceVersion(gopDir)
+  const ref = version || 'HEAD'
+  log.info(`Using gop source ${gopDir} at ${ref}`)
+  setOutput('gop-version-verified', !!version)
+  setOutput('matched-versions', JSON.stringify(version ? [version] : []))
+  setOutput('cache-hit', false)
+  if (ctx.command === 'install' && isWorkDir(gopDir)) {
+    // An extracted gop-archive is built where it stays, a gop-source-dir is
+    // the user's to keep.
+    gopDir = moveToGopRoot(gopDir, gopRootDir(gopBinDir()))
+  }
+  prepareSource(gopDir, 'HEAD', ctx.buildOptions)
+  if (ctx.command === 'validate') {
+    log.group(`Validating gop ${ref}`, () => validate(gopDir, ctx.buildOptions))
+    return null
+  }
+  const binDir = await ctx.tracer.spanAsync('build', async () =>
+    log.groupAsync(`Building gop ${ref}`, async () =>
+      install(gopDir, ctx.buildOptions)
+    )
+  )
+  return { version, ref, binDir, gopDir, rootDir: gopDir, source: 'source' }
+}
+
+// Throws unless dir holds the source of gop, i.e. a go.mod of its module.
+export function validateSourceDir(dir: string): void {
+  const goMod = path.join(dir, 'go.mod')
+  if (!fs.existsSync(goMod)) {
+    throw new Error(`gop-source-dir ${dir} is not a gop source tree, no go.mod`)
+  }
+  const match = fs
+    .readFileSync(goMod)
+    .toString()
+    .match(/^module\s+(\S+)/m)
+  if (!match || match[1] !== GOPLUS_MODULE) {
+    throw new Error(
+      `gop-source-dir ${dir} is not a gop source tree, its go.mod is not of module ${GOPLUS_MODULE}`
+    )
+  }
+}
+
+function describeTag(dir: string): string {
+  try {
+    return execFileSync('git', ['describe', '--tags', '--exact-match'], {
+      cwd: dir,
+      stdio: ['ignore', 'pipe', 'ignore']
+    })
+      .toString()
+      .trim()
+  } catch (error) {
+    log.debug(`No tag checked out in ${dir}: ${error}`)
+    return ''
+  }
+}
+
+/**
+ * Determines the version of the gop source in dir from the tag checked out,
+ * falling back to the gop directive of its gop.mod and then to the name of
+ * dir, like gop-1.2.3 for an extracted source archive.
+ * @returns {string} The version, or '' if none names a full version.
+ */
+export function sourceVersion(
+  dir: string,
+  describe: (dir: string) => string = describeTag
+): string {
+  const tag = normalizeVersion(describe(dir))
+  if (semver.valid(tag)) {
+    return tag
+  }
+  const gopMod = path.join(dir, 'gop.mod')
+  if (fs.existsSync(gopMod)) {
+    const version = parseGopVersionFile(gopMod)
+    if (semver.valid(version)) {
+      return version
+    }
+  }
+  const match = path.basename(dir).match(/^gop-v?(.+)$/)
+  return match && semver.valid(match[1]) ? match[1] : ''
+}
+
+function cloneSource(ctx: InstallContext, ref: string): string {
+  return ctx.tracer.span('clone', () =>
+    log.group(`Cloning gop ${ref}`, () =>
+      cloneBranchOrTag(ref, ctx.repo, ctx.buildOptions.timeout)
+    )
+  )
+}
+
+// Returns the commit gop was built from, or '' if the source tree is not a
+// git repo, e.g. an exported gop-source-dir.
+function builtCommit(installed: Installed): string {
+  try {
+    return gitHeadSHA(installed.gopDir)
+  } catch (error) {
+    log.warning(`Unable to tell the commit gop was built from: ${error}`)
+    return ''
+  }
+}
+
+/**
+ * Returns the commit checked out in the git repo dir, running git with run.
+ * @returns {string} The full SHA of HEAD.
+ */
+export function gitHeadSHA(
+  dir: string,
+  run: GitRunner = (args, cwd) => runGitWithRetry(args, cwd, { retries: 0 })
+): string {
+  const sha = run(['rev-parse', 'HEAD'], dir).trim()
+  if (!/^[0-9a-f]{40}([0-9a-f]{24})?$/.test(sha)) {
+    throw new Error(`Unexpected output of git rev-parse HEAD in ${dir}: ${sha}`)
+  }
+  return sha
+}
+
+/**
+ * Checks that the installed gop runs and, for a tagged install unless check is
+ * off, that it reports the selected version. Development branches may report
+ * a version that is not clean semver.
+ * @returns {boolean} Whether the version was checked.
+ */
+export function verifyInstall(
+  tracer: Tracer,
+  installed: Installed,
+  check = getInput('CHECK_VERSION') !== 'false'
+): boolean {
+  const { version, binDir } = installed
+  return tracer.span('verify', () => {
+    checkRunnable(binDir)
+    if (!version) {
+      return false
+    }
+    if (!check) {
+      log.info(`Skipped checking that gop reports version ${version}`)
+      return false
+    }
+    log.group(`Verifying gop ${version}`, () =>
+      checkVersion(version, binDir, getBooleanInput('STRICT_VERSION'))
+    )
+    return true
+  })
+}
+
+// The phases whose time is logged, by span name.
+const TIMED_PHASES: Record<string, string> = {
+  clone: 'Clone',
+  download: 'Download',
+  build: 'Build',
+  verify: 'Verify',
+  tools: 'Tool install'
+}
+
+// Logs how long a phase took, e.g. to tell whether caching is worth it.
+function logPhaseTime(span: Span): void {
+  const phase = TIMED_PHASES[span.name]
+  if (phase) {
+    log.info(`${phase} took ${((span.end - span.start) / 1000).toFixed(1)}s`)
+  }
+}
+
+/**
+ * Checks that the gop binary in binDir is executable, fixing missing execute
+ * bits, and runs gop version, as a zero exit of the build does not guarantee a
+ * runnable binary.
+ * @returns {string} The output of gop version.
+ */
+export function checkRunnable(binDir: string): string {
+  const gop = gopExecutable(binDir)
+  if (!fs.existsSync(gop)) {
+    throw new Error(`gop binary not found at ${gop}`)
+  }
+  if (ensureExecutable(gop)) {
+    log.warning(`${gop} was installed without execute permission, fixed`)
+  }
+  try {
+    const out = execFileSync(gop, ['version'], { stdio: 'pipe' }).toString()
+    log.debug(`gop version: ${out.trim()}`)
+    return out
+  } catch (error) {
+    const stderr = (error as { stderr?: Buffer }).stderr?.toString().trim()
+    throw new Error(`Installed gop ${gop} cannot run: ${stderr || error}`)
+  }
+}
+
+// Returns the directory of the gop found on PATH, or '' if there is none.
+function pathGopBinDir(): string {
+  const gop = findInPath('gop')
+  return gop && path.dirname(gop)
+}
+
+// Returns the version of the gop on PATH, or '' if there is none.
+function installedGopVersion(): string {
+  const binDir = pathGopBinDir()
+  if (!binDir) {
+    return ''
+  }
+  try {
+    return gopVersion(binDir)
+  } catch (error) {
+    log.debug(`Unable to get the version of gop in ${binDir}: ${error}`)
+    return ''
+  }
+}
+
+// Derives the spec of gop-version auto from the installed gop version: the
+// latest patch release of its minor version, or the latest release if gop is
+// not installed.
+export function autoVersionSpec(installed: string): string {
+  const version = semver.parse(normalizeVersion(installed))
+  return version ? `~${version.major}.${version.minor}` : 'latest'
+}
+
+/**
+ * Looks for a gop on PATH that already reports version, e.g. installed on a
+ * self-hosted runner by an earlier run, so that it need not be built again.
+ * @returns {string} Its bin dir, or '' if there is no such gop.
+ */
+export function findInstalledGop(
+  version: string,
+  lookup: () => string = pathGopBinDir,
+  gopVersionFunc: (binDir: string) => string = gopVersion
+): string {
+  const binDir = lookup()
+  if (!binDir) {
+    return ''
+  }
+  try {
+    const installed = gopVersionFunc(binDir)
+    log.debug('Found gop on PATH', { binDir, version: installed })
+    return sameVersion(installed, version) ? binDir : ''
+  } catch (error) {
+    log.debug(`Unable to get the version of gop in ${binDir}: ${error}`)
+    return ''
+  }
+}
+
+// Reports whether a gop reporting version found in foundDir can stand in for
+// installing it to binDir: only a plain build, like a prebuilt release, for
+// the runner's arch and in the same dir, never a race or custom build.
+export function canReuseInstalled(
+  version: string,
+  options: BuildOptions,
+  goarchForced: boolean,
+  foundDir: string,
+  binDir: string
+): boolean {
+  return (
+    usePrebuilt(version, options) &&
+    !options.go &&
+    !goarchForced &&
+    path.resolve(foundDir) === path.resolve(binDir)
+  )
+}
+
+// Returns the bin dir of a version installed by gop-versions.
+export function versionBinDir(version: string): string {
+  const name = version.replace(/[^\w.+-]/g, '_')
+  return path.join(os.homedir(), '.setup-goplus', name, 'bin')
+}
+
+interface Selection {
+  // The selected version, empty when installing from a branch.
+  version: string
+  // The tag or branch to check out.
+  ref: string
+}
+
+// Resolves the version spec and selects the gop version or branch to install.
+function selectGop(
+  repo: string,
+  tracer: Tracer,
+  spec?: string
+): Selection {
+  // Trim only the ends, whitespace inside ranges like '>=1.0.0 <2.0.0' is
+  // significant.
+  let versionSpec = tracer.span('resolve', () =>
+    (spec ?? resolveVersionInput().spec).trim()
+  )
+  if (versionSpec === 'auto') {
+    const installed = installedGopVersion()
+    versionSpec = autoVersionSpec(installed)
+    log.info(
+      installed
+        ? `Using ${versionSpec} for the installed gop ${installed}`
+        : 'No gop installed, using latest'
+    )
+  }
+  validateVersionSpec(versionSpec)
+  if (getInput('CHECK_REACHABILITY') !== 'false' && !tagsOffline(repo)) {
+    tracer.span('fetch', () =>
+      withMirrors(repo, gitMirrors(), remote => checkReachable(remote))
+    )
+  }
+  if (isCommitSHA(versionSpec)) {
+    log.info(`Installing gop at commit ${versionSpec}`)
+    setOutput('gop-version-verified', false)
+    setOutput('matched-versions', JSON.stringify([]))
+    return { version: '', ref: versionSpec }
+  }
+  // latest-N selects among all versions like latest, N releases back.
+  const offset = parseLatestOffset(versionSpec)
+  const range = offset === null ? expandPartialVersion(versionSpec) : 'latest'
+  if (offset === null && range !== versionSpec) {
+    log.info(`Expanded partial version ${versionSpec} to ${range}`)
+  }
+  const versionsFile = getInput('VERSIONS_FILE')
+  const tags = versionsFile ? [] : tracer.span('fetch', () => fetchTags(repo))
+  let candidates = versionsFile
+    ? loadVersionsFile(versionsFile)
+    : limitTags(
+        tags.map(normalizeVersion),
+        parseInt(getInput('MAX_TAGS') || '0', 10),
+        range
+      )
+  // A brand-new fork may have no release tags yet, install its default branch
+  // for latest instead.
+  if (
+    !versionsFile &&
+    !offset &&
+    (!range || range === 'latest') &&
+    !candidates.some(v => semver.valid(v))
+  ) {
+    const branch = tracer.span('fetch', () =>
+      resolveDefaultBranch(
+        defaultBranchCandidates(),
+        () => defaultBranch(repo),
+        () => fetchBranches(repo)
+      )
+    )
+    log.warning(
+      `No valid release tags found in ${maskUrl(repo)}, using the default branch ${branch}`
+    )
+    setOutput('gop-version-verified', false)
+    setOutput('matched-versions', JSON.stringify([]))
+    return { version: '', ref: branch }
+  }
+  const abiVersion = getInput('ABI_VERSION')
+  if (abiVersion) {
+    candidates = filterByAbi(
+      candidates,
+      abiVersion,
+      loadAbiManifest(getInput('ABI_MANIFEST'))
+    )
+  }
+  const zeroVerCaret = getInput('ZEROVER_CARET') || 'strict'
+  if (zeroVerCaret !== 'strict' && zeroVerCaret !== 'loose') {
+    throw new Error(
+      `Invalid zerover-caret '${zeroVerCaret}', expected strict or loose`
+    )
+  }
+  ensureReleaseTags(candidates, range, versionsFile || maskUrl(repo))
+  const major = getInput('MAJOR')
+  if (major) {
+    candidates = filterByMajor(candidates, major, range)
+  }
+  const matched = matchingVersions(candidates, range, {
+    zeroVerCaret,
+    track: getInput('TRACK'),
+    includePrerelease: getBooleanInput('INCLUDE_PRERELEASE')
+  })
+  const version = selectNthLatest(matched, offset || 0)
+  log.debug('Selected version', { versionSpec, version })
+  if (getBooleanInput('EXPLAIN')) {
+    const explanation = explainSelection(
+      versionSpec || 'latest',
+      candidates,
+      matched,
+      version
+    )
+    log.info(explanation)
+    setOutput('gop-version-explanation', explanation)
+  }
+  if (!versionSpec || versionSpec === 'latest') {
+    log.advisory(`No gop-version specified, using latest version: ${version}`)
+  } else if (!version && !neverBranch(versionSpec)) {
+    log.warning(
+      `No gop-version found that satisfies '${versionSpec}', trying branches...`
+    )
+  }
+
+  if (version) {
+    log.info(`Selected version ${version} by spec ${versionSpec}`)
+    checkDenied(version)
+    setOutput('gop-version-verified', true)
+    setOutput('matched-versions', JSON.stringify(matched))
+    return { version, ref: resolveTagRef(version, tags) }
+  }
+  if (neverBranch(versionSpec)) {
+    throw noMatchError(`No gop-version found that satisfies '${versionSpec}'`)
+  }
+  const branches = tracer.span('fetch', () => fetchBranches(repo))
+  const branch = matchBranch(branches, versionSpec)
+  if (!branch) {
+    throw noMatchError(
+      `No gop-version found that satisfies '${versionSpec}' in branches or tags`
+    )
+  }
+  log.warning(
+    `Unable to find a version that satisfies the version spec '${versionSpec}', using branch ${branch}`
+  )
+  setOutput('gop-version-verified', false)
+  setOutput('matched-versions', JSON.stringify([]))
+  return { version: '', ref: branch }
+}
+
+/**
+ * Returns the entry of denied, versions or ranges of known-bad releases, that
+ * version satisfies, or an empty string if it satisfies none.
+ */
+export function deniedBy(version: string, denied: string[]): string {
+  for (const entry of denied) {
+    if (!semver.validRange(entry)) {
+      throw new Error(
+        `Invalid deny-versions entry '${entry}', expected a version or range`
+      )
+    }
+    if (semver.satisfies(version, entry, { includePrerelease: true })) {
+      return entry
+    }
+  }
+  return ''
+}
+
+// Fails if version is denied by the deny-versions input, or only warns about
+// it when deny-action is warn.
+export function checkDenied(version: string): void {
+  const action = getInput('DENY_ACTION') || 'error'
+  if (action !== 'error' && action !== 'warn') {
+    throw new Error(`Invalid deny-action '${action}', expected error or warn`)
+  }
+  const entry = deniedBy(version, getListInput('DENY_VERSIONS'))
+  if (!entry) {
+    return
+  }
+  const message = `gop ${version} is denied by deny-versions '${entry}'`
+  if (action === 'warn') {
+    log.warning(message)
+    return
+  }
+  throw new Error(message)
+}
+
+function noMatchError(message: string): Error {
+  return Object.assign(new Error(message), { code: 'ENOMATCH' })
+}
+
+// Reports whether error is from a version spec that no tag or branch
+// satisfies.
+export function isNoMatch(error: unknown): boolean {
+  return (error as { code?: string } | null)?.code === 'ENOMATCH'
+}
+
+/**
+ * Selects a version with select, trying the fallback-version next if the
+ * primary spec is not satisfied by any tag or branch, e.g. when a requested
+ * version has not been tagged yet.
+ * @returns {{selection: T, fallbackUsed: boolean}} The selection, and whether
+ * it is of the fallback.
+ */
+export function selectWithFallback<T>(
+  select: (fallback?: string) => T,
+  fallback: string
+): { selection: T; fallbackUsed: boolean } {
+  try {
+    return { selection: select(), fallbackUsed: false }
+  } catch (error) {
+    if (!fallback || !isNoMatch(error)) {
+      throw error
+    }
+    log.warning(
+      `${(error as Error).message}, using the fallback-version ${fallback}`
+    )
+    return { selection: select(fallback), fallbackUsed: true }
+  }
+}
+
+// Reports whether a prebuilt release archive can stand in for building the
+// version from source. Archives are only published for tags, without race
+// detection or custom build tags.
+export function usePrebuilt(version: string, options: BuildOptions): boolean {
+  return (
+    !!version &&
+    !options.race &&
+    (options.tags || []).length === 0 &&
+    options.command === undefined &&
+    Object.keys(options.env || {}).length === 0
+  )
+}
+
+// Prepares the cloned gop source at ref for building, completing options with
+// what its go.mod requires.
+function prepareSource(
+  gopDir: string,
+  ref: string,
+  options: BuildOptions
+): void {
+  if (getBooleanInput('GOPATH_LAYOUT')) {
+    createGopathLayout(gopDir)
+  }
+  const goMod = readGoMod(gopDir, ref)
+  setOutput('min-go-version', minGoVersion(goMod, ref))
+  if (getBooleanInput('AUTO_GO_TOOLCHAIN')) {
+    options.toolchain = requiredGoToolchain(goMod)
+    if (options.toolchain) {
+      log.info(`Building gop with Go toolchain ${options.toolchain}`)
+    } else {
+      log.warning(
+        `Unable to derive the Go toolchain required by gop ${ref}, using the installed Go`
+      )
+    }
+  }
+  if (!options.toolchain) {
+    checkGoToolchain(gopDir, ref, options)
+  }
+  // Only a build depends on the runner OS, a prebuilt gop does not.
+  preflightOs(options.toolchain || buildGoVersion(options))
+}
+
+// Returns the version of the go the build runs, like go1.22.1, or an empty
+// string if it cannot be run.
+function buildGoVersion(options: BuildOptions): string {
+  try {
+    return execSync(`${goCommand(options)} env GOVERSION`).toString().trim()
+  } catch (error) {
+    return ''
+  }
+}
+
+// Fails with a clear error before building if the go the build runs is older
+// than the go directive of gop's go.mod, instead of a cryptic compile error.
+function checkGoToolchain(
+  gopDir: string,
+  ref: string,
+  options: BuildOptions
+): void {
+  let required: string
+  let actual: string
+  try {
+    required = parseGoModGoVersion(gopDir)
+    actual = execSync(`${goCommand(options)} env GOVERSION`).toString().trim()
+  } catch (error) {
+    log.warning(`Unable to check the go version for gop ${ref}: ${error}`)
+    return
+  }
+  const env = { ...process.env, ...options.env }
+  if (!goVersionSatisfies(actual, required, env['GOTOOLCHAIN'])) {
+    throw new Error(
+      `gop ${ref} requires go ${required}, but the runner has ${actual}. Install a newer Go, e.g. with actions/setup-go, or set auto-go-toolchain`
+    )
+  }
+}
+
+/**
+ * Reports whether the go reporting version actual, like go1.22.1, can build a
+ * module whose go directive is required, like 1.21. A go from 1.21 on
+ * downloads a newer toolchain itself, unless GOTOOLCHAIN forbids it.
+ * @returns {boolean} True if actual meets required or either is unknown.
+ */
+export function goVersionSatisfies(
+  actual: string,
+  required: string,
+  gotoolchain = ''
+): boolean {
+  const have = semver.coerce(actual)
+  const need = semver.coerce(required)
+  if (!have || !need || semver.gte(have, need)) {
+    return true
+  }
+  const mode = gotoolchain ? gotoolchain.split('+').pop() : 'auto'
+  return semver.gte(have, '1.21.0') && mode === 'auto'
+}
+
+// Fails before any network call if versionSpec is neither a version, a range
+// nor shaped like a git branch name (or branch glob) to fall back to.
+export function validateVersionSpec(versionSpec: string): void {
+  // semver reads an empty alternative as *, making '^1.2 ||' match anything.
+  if (
+    isVersionUnion(versionSpec) &&
+    versionSpec.split('||').some(alt => !alt.trim())
+  ) {
+    throw new Error(
+      `Invalid gop-version '${versionSpec}', every alternative of || must be a version or range`
+    )
+  }
+  if (
+    !versionSpec ||
+    versionSpec === 'latest' ||
+    versionSpec === 'stable' ||
+    semver.valid(versionSpec) ||
+    semver.validRange(versionSpec) ||
+    isBranchName(versionSpec)
+  ) {
+    return
+  }
+  throw new Error(
+    `Invalid gop-version '${versionSpec}', expected a version like 1.2.0, a range like ^1.2 or >=1.1.0 <1.3.0, latest, or a branch name`
+  )
+}
+
+// Reports whether versionSpec is a union of ranges like ^1.2 || ^2.0, which
+// never names a branch.
+export function isVersionUnion(versionSpec: string): boolean {
+  return versionSpec.includes('||')
+}
+
+// Reports whether versionSpec only selects among tags: a union of ranges or
+// the stable keyword, never falling back to a branch of the same name.
+function neverBranch(versionSpec: string): boolean {
+  return isVersionUnion(versionSpec) || versionSpec === 'stable'
+}
+
+// Reports whether name is shaped like a git branch name, allowing the glob
+// characters * and ? that matchBranch supports.
+function isBranchName(name: string): boolean {
+  return (
+    /^[^\s~^:[\\<>=|]+$/.test(name) &&
+    !/^[-./]|[./]$|\.\.|\/\/|@\{/.test(name)
+  )
+}
+
+// Fails with a clear error when the latest version is requested but versions,
+// listed from source, has no valid version to select it from.
+export function ensureReleaseTags(
+  versions: string[],
+  versionSpec: string,
+  source: string
+): void {
+  if (versionSpec && versionSpec !== 'latest') {
+    return
+  }
+  if (!versions.some(v => semver.valid(v))) {
+    throw new Error(
+      `No valid release tags found in ${source}, specify a gop-version branch or tag to install`
+    )
+  }
+}
+
+export interface SelectOptions {
+  // How a caret range below 1.0.0 is interpreted: strict follows semver, where
+  // ^0.2.0 means >=0.2.0 <0.3.0, loose allows any 0.x upgrade, i.e. <1.0.0.
+  zeroVerCaret?: 'strict' | 'loose'
+  // Restricts latest to stable releases and pre-releases on this track, e.g.
+  // rc for 1.2.0-rc.1.
+  track?: string
+  // false keeps latest from selecting a pre-release, unless a track is set.
+  // Ranges follow semver, only matching the pre-releases they name, like
+  // >=1.2.0-rc.0. Pre-releases are kept when unset.
+  includePrerelease?: boolean
+}
+
+export function selectVersion(
+  versions: string[],
+  versionSpec?: string,
+  options: SelectOptions = {}
+): string | null {
+  return matchingVersions(versions, versionSpec, options)[0] || null
+}
+
+/**
+ * Parses a spec selecting the N-th latest version, latest or latest-N.
+ * @returns {number | null} N, 0 for latest, or null for other specs.
+ */
+export function parseLatestOffset(versionSpec: string): number | null {
+  if (versionSpec === 'latest') {
+    return 0
+  }
+  const match = versionSpec.match(/^latest-(\d+)$/)
+  return match ? parseInt(match[1], 10) : null
+}
+
+// Returns the version offset releases back from the newest of versions, sorted
+// newest first, or an empty string if there are none.
+export function selectNthLatest(versions: string[], offset: number): string {
+  if (offset > 0 && offset >= versions.length) {
+    throw new Error(
+      `Unable to select latest-${offset}, only ${versions.length} versions match`
+    )
+  }
+  return versions[offset] || ''
+}
+
+/**
+ * Sorts the valid versions newest first. Versions of equal precedence, like
+ * 1.0.0+a and 1.0.0+b, are ordered by build metadata and then by their text,
+ * so that selecting the latest version is reproducible.
+ * @returns {string[]} The sorted versions, without invalid ones.
+ */
+export function sortVersions(versions: string[]): string[] {
+  return versions
+    .filter(v => semver.valid(v))
+    .sort((a, b) => semver.compareBuild(b, a) || b.localeCompare(a))
+}
+
+// Returns the valid versions satisfying versionSpec, newest first.
+export function matchingVersions(
+  versions: string[],
+  versionSpec?: string,
+  options: SelectOptions = {}
+): string[] {
+  const sortedVersions = sortVersions(versions)
+  versionSpec = versionSpec?.trim()
+  // An exact version, like 1.2.0-rc.1, selects precisely that version when it
+  // is listed, differing at most in build metadata, even if pre-releases are
+  // excluded.
+  if (versionSpec && semver.valid(versionSpec)) {
+    const spec = versionSpec
+    const exact = sortedVersions.filter(v => semver.eq(v, spec))
+    if (exact.length > 0) {
+      return exact
+    }
+  }
+  if (!versionSpec || versionSpec === 'latest') {
+    const track = options.track
+    if (track) {
+      return sortedVersions.filter(v => isOnTrack(v, track))
+    }
+    return options.includePrerelease === false
+      ? sortedVersions.filter(v => !semver.prerelease(v))
+      : sortedVersions
+  }
+  if (versionSpec === 'stable') {
+    return sortedVersions.filter(isStableVersion)
+  }
+  const range =
+    options.zeroVerCaret === 'loose'
+      ? expandZeroVerCaret(versionSpec)
+      : versionSpec
+  const matched = sortedVersions.filter(v => semver.satisfies(v, range))
+  log.debug('Matched versions', { range, candidates: sortedVersions, matched })
+  return matched
+}
+
+/**
+ * Describes how versionSpec was resolved against the candidate versions, to
+ * tell why a constraint selected an unexpected version.
+ * @returns {string} The number of candidates and matches, the selected version
+ * and the newest few of both.
+ */
+export function explainSelection(
+  versionSpec: string,
+  candidates: string[],
+  matched: string[],
+  selected: string,
+  top = 5
+): string {
+  const valid = sortVersions(candidates)
+  const list = (versions: string[]): string =>
+    versions.slice(0, top).join(', ') || 'none'
+  return [
+    `gop-version '${versionSpec}' matched ${matched.length} of ${valid.length} candidate versions,`,
+    selected ? `selected ${selected}.` : 'none selected.',
+    `Newest matches: ${list(matched)}.`,
+    `Newest candidates: ${list(valid)}.`
+  ].join(' ')
+}
+
+// Reports whether version is a plain X.Y.Z release, without pre-release or
+// build metadata, as selected by the stable spec.
+export function isStableVersion(version: string): boolean {
+  const v = normalizeVersion(version)
+  return /^\d+\.\d+\.\d+$/.test(v) && !!semver.valid(v)
+}
+
+// Reports whether version is a stable release or a pre-release on track.
+function isOnTrack(version: string, track: string): boolean {
+  const prerelease = semver.prerelease(version)
+  return !prerelease || String(prerelease[0]).startsWith(track)
+}
+
+// Rewrites caret ranges below 1.0.0 so that they allow any 0.x upgrade.
+export function expandZeroVerCaret(versionSpec: string): string {
+  return versionSpec.replace(
+    /\^\s*v?(0(\.(\d+|[xX*])){0,2}(-[0-9A-Za-z.-]+)?)(?![\w.+-])/g,
+    '>=$1 <1.0.0'
+  )
+}
+
+/**
+ * Clones versionSpec, a branch, tag or commit, of repo to a fresh work dir,
+ * running git with run.
+ * @returns {string} The directory of the clone.
+ */
+export function cloneBranchOrTag(
+  versionSpec: string,
+  repo: string,
+  timeout = 0,
+  run?: GitRunner
+): string {
+  // git clone https://github.com/goplus/gop.git with tag $versionSpec to $workDir/gop
+  const workDir = workDirPath()
+  clonedWorkDirs.push(workDir)
+  log.info(`Cloning gop ${versionSpec} to ${workDir} ...`)
+  const gopDir = path.join(workDir, 'gop')
+  // Forward the progress git reports, a clone can take minutes.
+  const options = { retries: gitRetries(), timeout, liveStderr: true }
+  const git: GitRunner =
+    run ?? ((args, dir, env) => runGitWithRetry(args, dir, { ...options, env }))
+  log.debug('Cloning', { ref: versionSpec, repo: maskUrl(repo), gopDir })
+  const depth = parseInt(getInput('CLONE_DEPTH') || '1', 10)
+  withMirrors(repo, gitMirrors(), remote => {
+    // Start over from an empty work dir after a failed attempt.
+    fs.rmSync(gopDir, { recursive: true, force: true })
+    for (const args of cloneCommands(versionSpec, remote, depth)) {
+      git(args, workDir, gitAuth(remote))
+    }
+  })
+  log.info('gop cloned')
+  return gopDir
+}
+
+/**
+ * Returns the git commands, run in the work dir, that clone ref of repo to
+ * gop with history of the given depth, 0 for the full history.
+ * @returns {string[][]} The arguments of each git command.
+ */
+export function cloneCommands(
+  ref: string,
+  repo: string,
+  depth = 1
+): string[][] {
+  if (isNaN(depth) || depth < 0) {
+    throw new Error(`Invalid clone-depth '${depth}', expected 0 or more`)
+  }
+  const depthArgs = depth > 0 ? ['--depth', `${depth}`] : []
+  if (!isCommitSHA(ref)) {
+    return [['clone', '--progress', ...depthArgs, '--branch', ref, repo, 'gop']]
+  }
+  // --branch only takes branch and tag names. A full commit SHA can be
+  // fetched on its own, an abbreviated one needs the full history.
+  if (depth > 0 && ref.length === 40) {
+    return [
+      ['init', '--quiet', 'gop'],
+      ['-C', 'gop', 'remote', 'add', 'origin', repo],
+      ['-C', 'gop', 'fetch', '--progress', ...depthArgs, 'origin', ref],
+      ['-C', 'gop', 'checkout', '--detach', 'FETCH_HEAD']
+    ]
+  }
+  return [
+    ['clone', '--progress', '--no-checkout', repo, 'gop'],
+    ['-C', 'gop', 'checkout', '--detach', ref]
+  ]
+}
+
+// Marks a work directory as created by this action, so that it can be safely
+// removed by later runs.
+const WORKDIR_MARKER = '.setup-goplus'
+
+// The work dirs gop was cloned to by this run, removed as it returns.
+let clonedWorkDirs: string[] = []
+
+// Returns a fresh work dir for a clone. Without the workdir input every clone
+// gets its own directory under RUNNER_TEMP, which the runner empties after the
+// job, so that parallel runs never share one.
+function workDirPath(): string {
+  const workDir = getInput('WORKDIR')
+  if (workDir) {
+    const dir = resolveDir(workDir)
+    prepareWorkDir(dir)
+    return dir
+  }
+  const tmp = process.env['RUNNER_TEMP'] || os.tmpdir()
+  return fs.mkdtempSync(path.join(tmp, 'setup-goplus-'))
+}
+
+// Decides whether the work dir is removed when the action returns, whether
+// the install succeeded or not, unless kept for debugging. Nothing installed
+// needs it: gop is built in its gop root, which is moved out of the work dir
+// first.
+export function shouldCleanWorkDir(keep: boolean): boolean {
+  return !keep
+}
+
+// Reports whether dir is in a work dir of this run.
+function isWorkDir(dir: string): boolean {
+  return clonedWorkDirs.some(workDir => {
+    const rel = path.relative(workDir, dir)
+    return !rel.startsWith('..') && !path.isAbsolute(rel)
+  })
+}
+
+// Removes the work dirs of this run, or logs where they were kept.
+function removeWorkDirs(): void {
+  const keep = !shouldCleanWorkDir(getBooleanInput('KEEP_WORKDIR'))
+  for (const workDir of clonedWorkDirs) {
+    if (keep) {
+      log.info(`Kept the work dir ${workDir}`)
+    } else {
+      cleanWorkDir(workDir)
+    }
+  }
+}
+
+// Removes the work dir, only warning if that fails so that the original error
+// is reported.
+export function cleanWorkDir(workDir: string): void {
+  try {
+    fs.rmSync(workDir, { recursive: true, force: true })
+    log.info(`Removed the work dir ${workDir}`)
+  } catch (error) {
+    log.warning(`Unable to remove the work dir ${workDir}: ${error}`)
+  }
+}
+
+// Writes the trace of the run to tracePath, only warning if that fails so that
+// the original error is reported.
+export function writeTrace(tracer: Tracer, tracePath: string): void {
+  try {
+    tracer.write(tracePath)
+  } catch (error) {
+    log.warning(`Unable to write the trace to ${tracePath}: ${error}`)
+  }
+}
+
+// Empties workDir for a fresh clone. A non-empty directory is only removed if
+// a previous run of this action owns it, to never delete user data.
+export function prepareWorkDir(workDir: string): void {
+  if (fs.existsSync(workDir)) {
+    const entries = fs.readdirSync(workDir)
+    if (entries.length > 0 && !entries.includes(WORKDIR_MARKER)) {
+      throw new Error(
+        `Refusing to remove ${workDir}: it is not empty and was not created by setup-goplus`
+      )
+    }
+    fs.rmSync(workDir, { recursive: true })
+  }
+  fs.mkdirSync(workDir, { recursive: true })
+  fs.writeFileSync(path.join(workDir, WORKDIR_MARKER), '')
+}
+
+/**
+ * Lists the released versions among tags, newest first, e.g. for generating a
+ * build matrix. Pre-releases are only listed if includePrerelease.
+ * @returns {string[]} At most limit versions, or all for a limit of 0.
+ */
+export function availableVersions(
+  tags: string[],
+  limit = 0,
+  includePrerelease = false
+): string[] {
+  const versions = matchingVersions(
+    [...new Set(tags.map(normalizeVersion))],
+    'latest',
+    { includePrerelease }
+  )
+  return limit > 0 ? versions.slice(0, limit) : versions
+}
+
+// Expands a partial version like 1 or 1.2 to the range of its latest patch,
+// ~1 or ~1.2, as setup-go does. Other specs are returned unchanged.
+export function expandPartialVersion(versionSpec: string): string {
+  const match = versionSpec.match(/^v?(\d+(\.\d+)?)$/)
+  return match ? `~${match[1]}` : versionSpec
+}
+
+// Reports whether versionSpec looks like a full or abbreviated git commit SHA,
+// 7 to 40 hex characters.
+export function isCommitSHA(versionSpec: string): boolean {
+  return /^[0-9a-f]{7,40}$/i.test(versionSpec)
+}
+
+// Reads go.mod of the gop source at ref, running git with run, returning an
+// empty string if it can not be read. A tree that is not a git checkout, like
+// an extracted gop-archive, is read as it is on disk.
+export function readGoMod(
+  gopDir: string,
+  ref: string,
+  run: GitRunner = (args, cwd) => runGitWithRetry(args, cwd, { retries: 0 })
+): string {
+  try {
+    if (!fs.existsSync(path.join(gopDir, '.git'))) {
+      return fs.readFileSync(path.join(gopDir, 'go.mod')).toString()
+    }
+    // A branch name may hold shell syntax, so git gets it as an argument.
+    return run(['show', `${ref}:go.mod`], gopDir)
+  } catch (error) {
+    log.warning(`Unable to read go.mod of gop ${ref}: ${error}`)
+    return ''
+  }
+}
+
+// Returns the go directive of goMod, of the gop source at ref.
+export function minGoVersion(goMod: string, ref: string): string {
+  const version = parseGoDirective(goMod)
+  if (!version) {
+    log.info(`No go directive found in go.mod of gop ${ref}`)
+  } else {
+    log.info(`gop ${ref} requires go ${version}`)
+  }
+  return version
+}
+
+// Returns the go directive of the go.mod in dir, empty if it has none.
+export function parseGoModGoVersion(dir: string): string {
+  const goMod = path.join(dir, 'go.mod')
+  let contents: string
+  try {
+    contents = fs.readFileSync(goMod).toString()
+  } catch (error) {
+    throw new Error(`Unable to read ${goMod}: ${error}`)
+  }
+  return parseGoDirective(contents)
+}
+
+export function parseGoDirective(goMod: string): string {
+  const match = goMod.match(/^go\s+(\d+(\.\d+)*)\s*$/m)
+  return match ? match[1] : ''
+}
+
+// Derives the GOTOOLCHAIN needed to build a gop whose go.mod is goMod, from
+// its toolchain directive or else its go directive. Toolchains can only be
+// switched to from Go 1.21.0 on, so older requirements yield an empty string.
+export function requiredGoToolchain(goMod: string): string {
+  const match = goMod.match(/^toolchain\s+(go\S+)\s*$/m)
+  if (match) {
+    return match[1]
+  }
+  const version = semver.coerce(parseGoDirective(goMod))
+  if (!version || semver.lt(version, '1.21.0')) {
+    return ''
+  }
+  return `go${version.version}`
+}
+
+export interface BuildOptions {
+  race?: boolean
+  tags?: string[]
+  toolchain?: string
+  // Path the build output is also written to, for uploading as an artifact.
+  logPath?: string
+  // Time limit of the build in milliseconds, 0 for no limit.
+  timeout?: number
+  // Replaces BUILD_COMMAND, e.g. for forks with a different make target.
+  command?: string
+  // Path of the go executable to build with instead of go on PATH.
+  go?: string
+  // Extra environment variables of the build, e.g. CGO_ENABLED=0.
+  env?: Record<string, string>
+}
+
+export const BUILD_COMMAND = 'go run cmd/make.go -install'
+
+// Returns the shell command gop is built with, normalized from the
+// build-command input if given.
+export function buildCommand(options: BuildOptions = {}): string {
+  if (options.command === undefined) {
+    return BUILD_COMMAND.replace(/^go /, `${goCommand(options)} `)
+  }
+  const args = splitCommand(options.command)
+  if (args.length === 0 || !args[0]) {
+    throw new Error('build-command must not be empty')
+  }
+  return args.map(shellQuote).join(' ')
+}
+
+/**
+ * Returns the platform to install gop for, the host's with the arch replaced
+ * by goarch if given. A goarch the runner cannot execute is warned about.
+ * @returns {Platform} The platform, also set as the gop-platform output.
+ */
+export function targetPlatform(
+  goarch: string,
+  host: Platform = detectPlatform()
+): Platform {
+  log.info(`Detected platform ${host.goos}/${host.goarch}`)
+  const platform = { ...host }
+  if (goarch) {
+    platform.goarch = normalizeGoarch(goarch)
+    if (platform.goarch !== host.goarch) {
+      log.warning(
+        `goarch ${goarch} does not match the ${host.goarch} runner, the installed gop will not run on it`
+      )
+    }
+  }
+  setOutput('gop-platform', `${platform.goos}/${platform.goarch}`)
+  return platform
+}
+
+// Returns the go command of the build, quoted for the shell.
+function goCommand(options: BuildOptions): string {
+  return options.go ? shellQuote(options.go) : 'go'
+}
+
+/**
+ * Checks that the go-binary input names an existing go executable and logs
+ * its version before anything is built with it.
+ * @returns {string} The absolute path of the go executable.
+ */
+export function checkGoBinary(go: string): string {
+  const goPath = path.resolve(go)
+  if (!fs.existsSync(goPath) || !fs.statSync(goPath).isFile()) {
+    throw new Error(`go-binary ${goPath} does not exist`)
+  }
+  let version: string
+  try {
+    version = execFileSync(goPath, ['version']).toString().trim()
+  } catch (error) {
+    throw new Error(`go-binary ${goPath} is not a working go: ${error}`)
+  }
+  log.info(`Building with ${version} from ${goPath}`)
+  return goPath
+}
+
+/**
+ * Fails with a clear error unless the command name is on PATH, instead of an
+ * opaque error when it is first run.
+ * @param hint How to get the command, appended to the error.
+ */
+export function requireCommand(
+  name: string,
+  hint: string,
+  lookup: (name: string) => string = findInPath
+): void {
+  if (!lookup(name)) {
+    throw new Error(`${name} is not installed or not on PATH. ${hint}`)
+  }
+}
+
+// Fails unless go is on PATH for building gop from source.
+function requireGo(): void {
+  requireCommand(
+    'go',
+    'Set up Go before this action, e.g. with actions/setup-go, or set go-binary.'
+  )
+}
+
+// Returns the directory gop is installed to, install-dir or $HOME/bin.
+function gopBinDir(): string {
+  const dir = expandHome(getInput('INSTALL_DIR'))
+  return resolveDir(dir || path.join(os.homedir(), 'bin'))
+}
+
+async function install(
+  gopDir: string,
+  options: BuildOptions = {},
+  bin: string = gopBinDir()
+): Promise<string> {
+  log.info(`Installing gop ${gopDir} ...`)
+  const command = buildCommand(options)
+  if (options.command !== undefined) {
+    log.info(`Building with ${command}`)
+  }
+  const env = buildEnv(bin, options)
+  const timeout = options.timeout || 0
+  logCommand(command, gopDir)
+  try {
+    if (options.logPath) {
+      log.info(`Writing build log to ${options.logPath}`)
+      await execTee(command, options.logPath, {
+        cwd: gopDir,
+        env,
+        timeout
+      })
+    } else {
+      execSync(command, { cwd: gopDir, stdio: 'inherit', env, timeout })
+    }
+  } catch (error) {
+    if (isTimeout(error)) {
+      throw new Error(
+        `Building gop exceeded the build-timeout of ${formatDuration(timeout)}, raise it or use a larger runner`
+      )
+    }
+    throw error
+  }
+  log.info('gop installed')
+  return bin
+}
+
+export const VALIDATE_COMMAND = 'go build ./...'
+
+// Checks that the gop source builds on this runner without installing it or
+// touching the PATH.
+export function validate(gopDir: string, options: BuildOptions = {}): void {
+  log.info(`Validating gop ${gopDir} builds ...`)
+  const timeout = options.timeout || 0
+  try {
+    execSync(VALIDATE_COMMAND.replace(/^go /, `${goCommand(options)} `), {
+      cwd: gopDir,
+      stdio: 'inherit',
+      env: buildEnv(gopBinDir(), options),
+      timeout
+    })
+  } catch (error) {
+    if (isTimeout(error)) {
+      throw new Error(
+        `Validating gop exceeded the build-timeout of ${formatDuration(timeout)}`
+      )
+    }
+    throw error
+  }
+  log.info('gop validated')
+}
+
+export const GOP_TEST_COMMAND = 'go test ./...'
+
+// The tools the gop VSCode extension uses, installed by the editor preset of
+// install-tools. Only the essential ones fail the install, as the others are
+// missing from some gop versions.
+export const EDITOR_TOOLS = {
+  essential: ['gopfmt'],
+  optional: ['gopls']
+}
+
+/**
+ * Expands the presets among the install-tools names, currently only editor.
+ * @returns {{tools: string[], optional: string[]}} The tools to install, and
+ * those of them whose failure is only warned about.
+ */
+export function expandToolPresets(names: string[]): {
+  tools: string[]
+  optional: string[]
+} {
+  const tools: string[] = []
+  const optional: string[] = []
+  for (const name of names) {
+    const preset = name === 'editor' ? EDITOR_TOOLS : null
+    for (const tool of preset ? preset.essential : [name]) {
+      if (!tools.includes(tool)) {
+        tools.push(tool)
       }
     }
+    for (const tool of preset ? preset.optional : []) {
+      if (!tools.includes(tool)) {
+        tools.push(tool)
+        optional.push(tool)
+      }
+    }
+  }
+  return { tools, optional }
+}
 
-    let checkoutVersion = ''
-    if (version) {
-      core.info(`Selected version ${version} by spec ${versionSpec}`)
-      checkoutVersion = `v${version}`
-      core.setOutput('gop-version-verified', true)
-    } else {
-      core.warning(
-        `Unable to find a version that satisfies the version spec '${versionSpec}', trying branches...`
-      )
-      checkoutVersion = versionSpec
-      core.setOutput('gop-version-verified', false)
+/**
+ * Installs the commands named tools from cmd/ of the gop source to the gop bin
+ * dir, e.g. gopfmt. Every tool is attempted, failing afterwards if any of them
+ * but the optional ones could not be built.
+ * @returns {string[]} The tools installed.
+ */
+export function installTools(
+  gopDir: string,
+  tools: string[],
+  options: BuildOptions = {},
+  bin: string = gopBinDir(),
+  optional: string[] = []
+): string[] {
+  const installed: string[] = []
+  const failed: string[] = []
+  for (const tool of tools) {
+    const pkg = `./cmd/${tool}`
+    if (!/^[\w.-]+$/.test(tool) || !fs.existsSync(path.join(gopDir, pkg))) {
+      log.warning(`Unknown tool ${tool}, gop has no ${pkg} command`)
+      failed.push(tool)
+      continue
     }
-    const gopDir = cloneBranchOrTag(checkoutVersion)
-    install(gopDir)
-    if (version) {
-      checkVersion(version)
+    try {
+      execSync(`${goCommand(options)} install ${pkg}`, {
+        cwd: gopDir,
+        stdio: 'inherit',
+        env: buildEnv(bin, options)
+      })
+      log.info(`Installed ${tool} to ${bin}`)
+      installed.push(tool)
+    } catch (error) {
+      log.warning(`Failed to install ${tool}: ${error}`)
+      failed.push(tool)
     }
-    core.setOutput('gop-version', gopVersion())
-  } catch (error) {
-    // Fail the workflow run if an error occurs
-    if (error instanceof Error) core.setFailed(error.message)
   }
+  const essential = failed.filter(tool => !optional.includes(tool))
+  if (essential.length > 0) {
+    throw new Error(`Failed to install tools: ${essential.join(', ')}`)
+  }
+  return installed
 }
 
-export function selectVersion(
-  versions: string[],
-  versionSpec?: string
-): string | null {
-  const sortedVersions = semver.rsort(versions.filter(v => semver.valid(v)))
-  if (!versionSpec || versionSpec === 'latest') {
-    return sortedVersions[0]
+// Runs the test suite of the gop source with the go and env gop was built
+// with, failing if any test fails.
+export function runGopTests(
+  tracer: Tracer,
+  gopDir: string,
+  options: BuildOptions = {}
+): void {
+  tracer.span('test', () =>
+    log.group(`Testing gop ${gopDir}`, () => {
+      try {
+        execSync(GOP_TEST_COMMAND.replace(/^go /, `${goCommand(options)} `), {
+          cwd: gopDir,
+          stdio: 'inherit',
+          env: buildEnv(gopBinDir(), options)
+        })
+      } catch (error) {
+        throw new Error(`gop tests failed in ${gopDir}: ${error}`)
+      }
+    })
+  )
+  log.info('gop tests passed')
+}
+
+export function buildEnv(
+  bin: string,
+  options: BuildOptions,
+  baseEnv: NodeJS.ProcessEnv = process.env
+): NodeJS.ProcessEnv {
+  const env: NodeJS.ProcessEnv = { ...baseEnv, GOBIN: bin, ...options.env }
+  const goflags = env['GOFLAGS'] ? [env['GOFLAGS']] : []
+  if (options.race) {
+    if (isCrossBuild(env)) {
+      throw new Error(
+        `build-race can not be used when cross building for ${env['GOOS'] || ''}/${env['GOARCH'] || ''}`
+      )
+    }
+    log.warning(
+      'Building gop with the race detector, the build is slower and the binary larger'
+    )
+    goflags.push('-race')
+    env['CGO_ENABLED'] = '1'
+  }
+  if (options.tags && options.tags.length > 0) {
+    goflags.push(`-tags=${options.tags.join(',')}`)
+  }
+  if (goflags.length > 0) {
+    env['GOFLAGS'] = goflags.join(' ')
   }
-  return semver.maxSatisfying(sortedVersions, versionSpec)
+  if (options.toolchain) {
+    env['GOTOOLCHAIN'] = options.toolchain
+  }
+  if (options.go) {
+    // Commands the build runs itself, like cmd/make.go running go build, use
+    // the same go.
+    const dir = path.dirname(options.go)
+    env['PATH'] = env['PATH'] ? `${dir}${path.delimiter}${env['PATH']}` : dir
+  }
+  return env
 }
 
-function cloneBranchOrTag(versionSpec: string): string {
-  // git clone https://github.com/goplus/gop.git with tag $versionSpec to $HOME/workdir/gop
-  const workDir = path.join(os.homedir(), 'workdir')
-  if (fs.existsSync(workDir)) {
-    fs.rmSync(workDir, { recursive: true })
+/**
+ * Parses the build-env input, one KEY=VALUE pair per line. Blank lines are
+ * skipped, quotes around a value are removed and malformed lines are ignored
+ * with a warning.
+ * @returns {Record<string, string>} The variables to add to the build env.
+ */
+export function parseBuildEnv(input: string): Record<string, string> {
+  const env: Record<string, string> = {}
+  for (const raw of input.split(/\r?\n/)) {
+    const line = raw.trim()
+    if (!line) {
+      continue
+    }
+    const eq = line.indexOf('=')
+    const key = eq > 0 ? line.slice(0, eq).trim() : ''
+    if (!/^[A-Za-z_][A-Za-z0-9_]*$/.test(key)) {
+      log.warning(
+        `Ignoring malformed build-env line '${line}', expected KEY=VALUE`
+      )
+      continue
+    }
+    env[key] = line.slice(eq + 1).trim().replace(/^(['"])(.*)\1$/, '$2')
   }
-  fs.mkdirSync(workDir)
-  core.info(`Cloning gop ${versionSpec} to ${workDir} ...`)
-  const cmd = `git clone --depth 1 --branch ${versionSpec} ${GOPLUS_REPO}`
-  execSync(cmd, { cwd: workDir, stdio: 'inherit' })
-  core.info('gop cloned')
-  return path.join(workDir, 'gop')
+  return env
 }
 
-function install(gopDir: string): void {
-  core.info(`Installing gop ${gopDir} ...`)
-  const bin = path.join(os.homedir(), 'bin')
-  execSync('go run cmd/make.go -install', {
-    cwd: gopDir,
-    stdio: 'inherit',
-    env: {
-      ...process.env,
-      GOBIN: bin
+export const SMOKE_TEST_SOURCE = 'println "Hello, Go+"\n'
+export const SMOKE_TEST_OUTPUT = 'Hello, Go+'
+
+// Builds and runs a hello world program with the installed gop, catching
+// installs where the binary runs but cannot compile.
+export function smokeTest(binDir: string): void {
+  const gop = gopExecutable(binDir)
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'gop-smoke-'))
+  try {
+    fs.writeFileSync(path.join(dir, 'hello.gop'), SMOKE_TEST_SOURCE)
+    let out: string
+    try {
+      out = execFileSync(gop, ['run', 'hello.gop'], {
+        cwd: dir,
+        env: process.env,
+        stdio: 'pipe'
+      }).toString()
+    } catch (error) {
+      const stderr = (error as { stderr?: Buffer }).stderr?.toString().trim()
+      throw new Error(`gop smoke test failed: ${stderr || error}`)
     }
-  })
-  core.addPath(bin)
-  core.info('gop installed')
+    if (out.trim() !== SMOKE_TEST_OUTPUT) {
+      throw new Error(
+        `gop smoke test printed '${out.trim()}', expected '${SMOKE_TEST_OUTPUT}'`
+      )
+    }
+    log.info('gop smoke test passed')
+  } finally {
+    try {
+      fs.rmSync(dir, { recursive: true, force: true })
+    } catch (error) {
+      log.warning(`Unable to remove ${dir}: ${error}`)
+    }
+  }
 }
 
-function checkVersion(versionSpec: string): string {
-  core.info(`Testing gop ${versionSpec} ...`)
-  const actualVersion = gopVersion()
-  if (actualVersion !== versionSpec) {
+function checkVersion(
+  versionSpec: string,
+  binDir: string,
+  strict = false
+): string {
+  log.info(`Testing gop ${versionSpec} ...`)
+  const actualVersion = gopVersionWithRetry(binDir)
+  if (!versionMatches(actualVersion, versionSpec, strict)) {
     throw new Error(
       `Installed gop version ${actualVersion} does not match expected version ${versionSpec}`
     )
   }
-  core.info(`Installed gop version ${actualVersion}`)
+  log.info(`Installed gop version ${actualVersion}`)
   return actualVersion
 }
 
-function gopVersion(): string {
-  const out = execSync('gop env GOPVERSION', { env: process.env })
-  return out.toString().trim().replace(/^v/, '')
+// Strips the v prefix and surrounding whitespace of a version, so that tags,
+// specs and gop's reported version compare equal regardless of formatting.
+export function normalizeVersion(version: string): string {
+  return version.trim().replace(/^v/, '')
 }
 
-function fetchTags(): string[] {
-  const cmd = `git -c versionsort.suffix=- ls-remote --tags --sort=v:refname ${GOPLUS_REPO}`
-  const out = execSync(cmd).toString()
-  const versions = out
-    .split('\n')
-    .filter(s => s)
-    .map(s => s.split('\t')[1].replace('refs/tags/', ''))
-    .map(s => s.replace(/^v/, ''))
-  return versions
+export function sameVersion(a: string, b: string): boolean {
+  return normalizeVersion(a) === normalizeVersion(b)
+}
+
+/**
+ * Reports whether the installed gop version matches the expected one. Unless
+ * strict, versions differing only in build metadata match, as semver gives it
+ * no precedence, and the difference is logged.
+ * @returns {boolean} Whether the versions match.
+ */
+export function versionMatches(
+  actual: string,
+  expected: string,
+  strict = false
+): boolean {
+  if (sameVersion(actual, expected)) {
+    return true
+  }
+  const a = semver.parse(normalizeVersion(actual))
+  const e = semver.parse(normalizeVersion(expected))
+  if (strict || !a || !e || !semver.eq(a, e)) {
+    return false
+  }
+  log.info(
+    `Installed gop version ${actual} differs from ${expected} only in build metadata`
+  )
+  return true
+}
+
+// Returns the path of the gop binary in binDir, gop.exe on Windows.
+export function gopExecutable(
+  binDir: string,
+  platform: NodeJS.Platform = process.platform
+): string {
+  return path.join(binDir, executableName('gop', platform))
+}
+
+function gopVersion(binDir: string): string {
+  const gop = gopExecutable(binDir)
+  if (!fs.existsSync(gop)) {
+    throw new Error(`gop binary not found at ${gop}`)
+  }
+  const out = execSync(`"${gop}" env GOPVERSION`, { env: process.env })
+  return parseGopVersionOutput(out.toString())
+}
+
+export interface VersionRetryOptions {
+  attempts?: number
+  // Delay between attempts, in milliseconds.
+  delay?: number
+  sleep?: (ms: number) => void
+  gopVersionFunc?: (binDir: string) => string
+}
+
+/**
+ * Gets the version of the gop in binDir, retrying a few times as a freshly
+ * installed binary may not be usable at once on slow runners.
+ * @returns {string} The version gop reports.
+ */
+export function gopVersionWithRetry(
+  binDir: string,
+  options: VersionRetryOptions = {}
+): string {
+  const attempts = options.attempts ?? 3
+  const delay = options.delay ?? 500
+  const wait = options.sleep || sleepSync
+  const gopVersionFunc = options.gopVersionFunc || gopVersion
+  for (let attempt = 1; ; attempt++) {
+    try {
+      return gopVersionFunc(binDir)
+    } catch (error) {
+      if (attempt >= attempts) {
+        throw error
+      }
+      log.warning(
+        `Unable to get the gop version (${attempt}/${attempts}), retrying in ${delay}ms: ${error}`
+      )
+      wait(delay)
+    }
+  }
+}
+
+// Extracts the version from `gop env GOPVERSION` output, tolerating quotes,
+// CRLF line endings and surrounding whitespace.
+export function parseGopVersionOutput(out: string): string {
+  const line =
+    out
+      .split(/\r?\n/)
+      .map(s => s.trim())
+      .find(s => s) || ''
+  const version = normalizeVersion(line.replace(/^(['"])(.*)\1$/, '$2'))
+  if (!/^\d+\.\d+(\.\d+)?([-+][0-9A-Za-z.+-]*)?$/.test(version)) {
+    throw new Error(
+      `Unable to parse gop version from 'gop env GOPVERSION' output: ${JSON.stringify(out)}`
+    )
+  }
+  return version
+}
+
+/**
+ * Returns the variables authenticating git with token to a custom https repo
+ * on the GitHub instance at serverUrl, e.g. a private fork. The token is sent
+ * as a header configured through the environment of the single command, kept
+ * out of its command line and the clone's remote URL, and is masked in the
+ * log. Config entries already in baseEnv are kept.
+ * @returns {Record<string, string>} The variables to add to the environment
+ * of git, empty for the upstream repo, a repo on another host or without a
+ * token.
+ */
+export function gitAuthEnv(
+  repo: string,
+  token: string,
+  serverUrl: string = GITHUB_URL,
+  baseEnv: NodeJS.ProcessEnv = process.env
+): Record<string, string> {
+  if (
+    !token ||
+    repo === GOPLUS_REPO ||
+    !/^https:\/\//i.test(repo) ||
+    !isGitHubUrl(repo, serverUrl)
+  ) {
+    return {}
+  }
+  const basic = Buffer.from(`x-access-token:${token}`).toString('base64')
+  core.setSecret(basic)
+  const index = parseInt(baseEnv['GIT_CONFIG_COUNT'] || '0', 10) || 0
+  return {
+    GIT_CONFIG_COUNT: `${index + 1}`,
+    [`GIT_CONFIG_KEY_${index}`]: 'http.extraheader',
+    [`GIT_CONFIG_VALUE_${index}`]: `AUTHORIZATION: basic ${basic}`
+  }
+}
+
+function gitAuth(repo: string): Record<string, string> {
+  // The token is for the gop repo, mirrors are never sent it.
+  if (gitMirrors().includes(repo)) {
+    return {}
+  }
+  return gitAuthEnv(repo, getInput('TOKEN'), githubServerUrl())
+}
+
+// Returns the mirrors of the gop repo given by the mirrors input, tried in
+// order when the gop repo fails.
+function gitMirrors(): string[] {
+  const mirrors = getListInput('MIRRORS')
+  for (const mirror of mirrors) {
+    if (!isGitRemote(mirror)) {
+      throw new Error(
+        `Invalid mirror '${maskUrl(mirror)}', expected a git remote URL`
+      )
+    }
+  }
+  return mirrors
+}
+
+/**
+ * Runs fn on repo and, if that fails, on each of mirrors in order, so that a
+ * rate-limited or unreachable gop repo doesn't fail the action. fn gets the
+ * same refs from every mirror, so versions are selected the same way.
+ * @returns {T} The result of the first remote fn succeeds on.
+ */
+export function withMirrors<T>(
+  repo: string,
+  mirrors: string[],
+  fn: (remote: string) => T
+): T {
+  try {
+    return fn(repo)
+  } catch (error) {
+    if (mirrors.length === 0) {
+      throw error
+    }
+    log.warning(`${maskUrl(repo)} failed, trying its mirrors: ${error}`)
+    for (const mirror of mirrors) {
+      try {
+        const result = fn(mirror)
+        log.info(`Using mirror ${maskUrl(mirror)}`)
+        return result
+      } catch (mirrorError) {
+        log.warning(`Mirror ${maskUrl(mirror)} failed: ${mirrorError}`)
+      }
+    }
+    throw error
+  }
+}
+
+// Time limit of the reachability probe in milliseconds.
+const PROBE_TIMEOUT = 15 * 1000
+
+// Fails fast with a clear error if repo can't be reached, using a cheap probe
+// run by run rather than waiting for a long fetch or clone to time out. The
+// probe is tried once, the fetch it guards retries.
+export function checkReachable(
+  repo: string,
+  run: GitRunner = (args, dir, env) =>
+    runGitWithRetry(args, dir, { retries: 0, timeout: PROBE_TIMEOUT, env })
+): void {
+  try {
+    run(['ls-remote', '--exit-code', repo, 'HEAD'], undefined, gitAuth(repo))
+  } catch (error) {
+    log.debug('Reachability probe failed', { error: `${error}` })
+    throw new Error(
+      `Cannot reach ${maskUrl(repo)}, check the network connection of the runner`
+    )
+  }
+}
+
+// Reports whether the tags of repo are listed without the network, from the
+// versions-file or the refs cache, so that offline runs skip the probe.
+export function tagsOffline(repo: string): boolean {
+  return (
+    !!getInput('VERSIONS_FILE') ||
+    (!getBooleanInput('REFRESH_TAGS') &&
+      readRefsCache(`${repo} --tags`) !== null)
+  )
+}
+
+// Returns the gop repository to install from, goplus/gop on the GitHub
+// instance unless overridden by the gop-repo input.
+export function gopRepo(): string {
+  const repo = getInput('GOP_REPO') || upstreamRepo(githubServerUrl())
+  if (!isGitRemote(repo)) {
+    throw new Error(
+      `Invalid gop-repo '${maskUrl(repo)}', expected a git remote URL`
+    )
+  }
+  return repo
+}
+
+// Reports whether url is a well-formed git remote: a URL with a scheme git
+// supports, or the scp-like form [user@]host:path.
+export function isGitRemote(url: string): boolean {
+  if (/^[a-z][a-z0-9+.-]*:\/\//i.test(url)) {
+    try {
+      const parsed = new URL(url)
+      const protocols = ['https:', 'http:', 'ssh:', 'git:', 'file:']
+      return (
+        protocols.includes(parsed.protocol) &&
+        (parsed.protocol === 'file:' || !!parsed.hostname) &&
+        parsed.pathname.length > 1
+      )
+    } catch (error) {
+      return false
+    }
+  }
+  return /^([\w.-]+@)?[\w.-]+:[^\s:][^\s]*$/.test(url)
+}
+
+// Hides the credentials of a URL for logging.
+export function maskUrl(url: string): string {
+  return url.replace(/^([a-z][a-z0-9+.-]*:\/\/)[^/@]+@/i, '$1***@')
+}
+
+// Lists the refs of the gop repo of the given kind, --tags or --heads, sorted
+// ascending by version. Listings are cached for a few minutes, so that matrix
+// jobs on the same runner don't list them over and over.
+function lsRemote(
+  kind: string,
+  repo: string,
+  run: GitRunner = (args, dir, env) =>
+    runGitWithRetry(args, dir, { retries: gitRetries(), env })
+): string {
+  const key = `${repo} ${kind}`
+  if (!getBooleanInput('REFRESH_TAGS')) {
+    const cached = readRefsCache(key)
+    if (cached !== null) {
+      log.info(`Using cached ${kind.slice(2)} of ${maskUrl(repo)}`)
+      return cached
+    }
+  }
+  const out = withMirrors(repo, gitMirrors(), remote =>
+    run(
+      [
+        '-c',
+        'versionsort.suffix=-',
+        'ls-remote',
+        kind,
+        '--sort=v:refname',
+        remote
+      ],
+      undefined,
+      gitAuth(remote)
+    )
+  )
+  writeRefsCache(key, out)
+  return out
+}
+
+// Returns the number of times a failed git network operation is retried.
+function gitRetries(): number {
+  const retries = parseInt(getInput('RETRY_COUNT') || '3', 10)
+  if (isNaN(retries) || retries < 0) {
+    throw new Error(
+      `Invalid retry-count '${getInput('RETRY_COUNT')}', expected a number >= 0`
+    )
+  }
+  return retries
+}
+
+/**
+ * Parses the tag names of git ls-remote --tags output, stripping the ^{} of
+ * peeled annotated tags. Tags naming the same version, like 1.2.3 and v1.2.3,
+ * are listed once, by the v-prefixed name.
+ * @returns {string[]} The tag names, in the order listed.
+ */
+export function parseTagRefs(out: string): string[] {
+  const tags: string[] = []
+  const seen = new Map<string, number>()
+  for (const line of out.split('\n')) {
+    const ref = line.split('\t')[1]
+    if (!ref) {
+      continue
+    }
+    const tag = ref.trim().replace('refs/tags/', '').replace(/\^\{\}$/, '')
+    const key = normalizeVersion(tag)
+    const index = seen.get(key)
+    if (index === undefined) {
+      seen.set(key, tags.length)
+      tags.push(tag)
+    } else if (tag.startsWith('v') && !tags[index].startsWith('v')) {
+      tags[index] = tag
+    }
+  }
+  return tags
+}
+
+// Returns the tag names of repo as is, sorted ascending by version.
+export function fetchTags(repo: string, run?: GitRunner): string[] {
+  const tags = parseTagRefs(lsRemote('--tags', repo, run))
+  log.debug('Fetched tags', { repo: maskUrl(repo), tags })
+  return tags
+}
+
+// Returns the tag to check out for a selected version. Selection works on
+// normalized versions, so map back to the tag that produced version when the
+// reconstructed v-prefixed ref does not exist. Without known tags, e.g. when
+// selecting from a versions file, the reconstructed ref is used.
+export function resolveTagRef(version: string, tags: string[]): string {
+  const ref = `v${version}`
+  if (tags.length === 0 || tags.includes(ref)) {
+    return ref
+  }
+  const original = tags.find(t => sameVersion(t, version))
+  if (!original) {
+    throw new Error(`No tag found for gop version ${version}`)
+  }
+  log.info(`Using tag ${original} for gop version ${version}`)
+  return original
+}
+
+// Keeps only the max highest of tags, which are sorted ascending by git, when
+// versionSpec is unbounded. Bounded specs may match older versions and see all
+// tags.
+export function limitTags(
+  tags: string[],
+  max: number,
+  versionSpec: string
+): string[] {
+  const unbounded =
+    !versionSpec || ['latest', 'stable', '*'].includes(versionSpec)
+  if (!max || max < 0 || !unbounded || tags.length <= max) {
+    return tags
+  }
+  log.info(`Considering only the ${max} highest of ${tags.length} tags`)
+  return tags.slice(-max)
+}
+
+// Finds the branch named by pattern, which may be a glob like release/* that
+// resolves to the highest matching branch, comparing numbers numerically.
+export function matchBranch(
+  branches: string[],
+  pattern: string
+): string | null {
+  if (!/[*?]/.test(pattern)) {
+    return branches.includes(pattern) ? pattern : null
+  }
+  const matching = branches
+    .filter(b => globToRegExp(pattern).test(b))
+    .sort((a, b) => b.localeCompare(a, 'en', { numeric: true }))
+  return matching[0] || null
+}
+
+function globToRegExp(pattern: string): RegExp {
+  let source = ''
+  for (const c of pattern) {
+    if (c === '*') {
+      source += '[^/]*'
+    } else if (c === '?') {
+      source += '[^/]'
+    } else {
+      source += c.replace(/[.+^${}()|[\]\\]/g, '\\$&')
+    }
+  }
+  return new RegExp(`^${source}$`)
+}
+
+// Loads the candidate versions from a vendored JSON array of version strings,
+// so selection does not depend on the network.
+export function loadVersionsFile(versionsFile: string): string[] {
+  if (!fs.existsSync(versionsFile)) {
+    throw new Error(
+      `The specified versions file at: ${versionsFile} does not exist`
+    )
+  }
+  let versions: unknown
+  try {
+    versions = JSON.parse(fs.readFileSync(versionsFile).toString())
+  } catch (error) {
+    throw new Error(
+      `The versions file at: ${versionsFile} is not valid JSON: ${error}`
+    )
+  }
+  if (
+    !Array.isArray(versions) ||
+    !versions.every(v => typeof v === 'string')
+  ) {
+    throw new Error(
+      `The versions file at: ${versionsFile} must be a JSON array of version strings`
+    )
+  }
+  log.info(`Loaded ${versions.length} versions from ${versionsFile}`)
+  return versions.map(normalizeVersion)
+}
+
+// Loads a JSON object mapping gop versions to the ABI version they expose,
+// returning null if it is unavailable.
+export function loadAbiManifest(
+  manifestPath: string
+): Record<string, string> | null {
+  if (!manifestPath || !fs.existsSync(manifestPath)) {
+    return null
+  }
+  try {
+    const manifest = JSON.parse(fs.readFileSync(manifestPath).toString())
+    if (typeof manifest !== 'object' || Array.isArray(manifest) || !manifest) {
+      throw new Error('expected a JSON object')
+    }
+    const abis: Record<string, string> = {}
+    for (const [version, abi] of Object.entries(manifest)) {
+      abis[normalizeVersion(version)] = String(abi)
+    }
+    return abis
+  } catch (error) {
+    log.warning(`Unable to read the ABI manifest at ${manifestPath}: ${error}`)
+    return null
+  }
+}
+
+// Keeps the versions exposing abiVersion. Without ABI data the versions are
+// returned unfiltered.
+export function filterByAbi(
+  versions: string[],
+  abiVersion: string,
+  abis: Record<string, string> | null
+): string[] {
+  if (!abis) {
+    log.warning(`No ABI data available, ignoring abi-version ${abiVersion}`)
+    return versions
+  }
+  const compatible = versions.filter(v => abis[v] === abiVersion)
+  log.info(
+    `${compatible.length} of ${versions.length} versions expose ABI ${abiVersion}`
+  )
+  return compatible
+}
+
+/**
+ * Keeps the versions of the major line major, e.g. 1 for 1.x, so that latest
+ * picks the newest release of that line. A versionSpec naming a version or
+ * range is intersected with it, warning when they cannot both be satisfied.
+ * @returns {string[]} The versions of the major line.
+ */
+export function filterByMajor(
+  versions: string[],
+  major: string,
+  versionSpec = ''
+): string[] {
+  if (!/^\d+$/.test(major)) {
+    throw new Error(`Invalid major '${major}', expected a number like 1`)
+  }
+  const n = parseInt(major, 10)
+  const line = `${n}.x`
+  const spec = versionSpec.trim()
+  const keyword =
+    !spec || spec === 'stable' || parseLatestOffset(spec) !== null
+  if (!keyword && !semver.validRange(spec)) {
+    log.warning(`Ignoring major ${major} for the gop-version branch ${spec}`)
+    return versions
+  }
+  if (
+    !keyword &&
+    !semver.intersects(spec, line, { includePrerelease: true })
+  ) {
+    log.warning(
+      `gop-version '${spec}' does not overlap major ${major}, no version can satisfy both`
+    )
+  }
+  const kept = versions.filter(v => semver.valid(v) && semver.major(v) === n)
+  log.info(`${kept.length} of ${versions.length} versions are on major ${line}`)
+  if (kept.length === 0) {
+    throw noMatchError(`No gop version found on major ${line}`)
+  }
+  return kept
 }
 
-function fetchBranches(): string[] {
-  const cmd = `git -c versionsort.suffix=- ls-remote --heads --sort=v:refname ${GOPLUS_REPO}`
-  const out = execSync(cmd).toString()
+// Lists the branches of repo.
+export function fetchBranches(repo: string, run?: GitRunner): string[] {
+  const out = lsRemote('--heads', repo, run)
   const versions = out
     .split('\n')
     .filter(s => s)
@@ -137,30 +2412,145 @@ function fetchBranches(): string[] {
   return versions
 }
 
-function resolveVersionInput(): string | undefined {
-  let version = process.env['INPUT_GOP_VERSION']
-  const versionFilePath = process.env['INPUT_GOP_VERSION_FILE']
+// Returns the default branch of repo, as pointed to by its HEAD, running git
+// with run.
+export function defaultBranch(
+  repo: string,
+  run: GitRunner = (args, dir, env) =>
+    runGitWithRetry(args, dir, { retries: gitRetries(), env })
+): string {
+  const out = withMirrors(repo, gitMirrors(), remote =>
+    run(['ls-remote', '--symref', remote, 'HEAD'], undefined, gitAuth(remote))
+  )
+  const branch = parseSymref(out)
+  if (!branch) {
+    throw new Error(`HEAD of ${maskUrl(repo)} is not a branch`)
+  }
+  return branch
+}
+
+// Parses the branch HEAD points to from `git ls-remote --symref <repo> HEAD`.
+export function parseSymref(out: string): string {
+  const match = out.match(/^ref:\s+refs\/heads\/(\S+)\s+HEAD$/m)
+  return match ? match[1] : ''
+}
+
+const DEFAULT_BRANCH_CANDIDATES = ['main', 'master']
+
+function defaultBranchCandidates(): string[] {
+  const candidates = getListInput('DEFAULT_BRANCH_CANDIDATES')
+  return candidates.length > 0 ? candidates : DEFAULT_BRANCH_CANDIDATES
+}
+
+/**
+ * Resolves the default branch of the gop repo. If looking it up fails, e.g. on
+ * mirrors without a symbolic HEAD, the first existing candidate is used.
+ * @returns {string} The default branch.
+ */
+export function resolveDefaultBranch(
+  candidates: string[] = defaultBranchCandidates(),
+  lookup: () => string = () => defaultBranch(gopRepo()),
+  listBranches: () => string[] = () => fetchBranches(gopRepo())
+): string {
+  try {
+    const branch = lookup()
+    log.info(`Default branch of the gop repo is ${branch}`)
+    return branch
+  } catch (error) {
+    log.warning(
+      `Unable to look up the default branch of the gop repo: ${error}`
+    )
+  }
+  const branches = listBranches()
+  for (const candidate of candidates) {
+    if (branches.includes(candidate)) {
+      log.info(`Using ${candidate} as the default branch`)
+      return candidate
+    }
+    log.info(`Default branch candidate ${candidate} does not exist`)
+  }
+  throw new Error(
+    `Unable to resolve the default branch of the gop repo, none of ${candidates.join(', ')} exist`
+  )
+}
+
+// Where the gop version spec came from, in order of precedence.
+export type VersionSource =
+  | 'gop-version'
+  | 'gop-version-file'
+  | '.gop-version'
+  | 'gop.mod'
+  | 'latest'
+
+export interface VersionInput {
+  spec: string
+  source: VersionSource
+}
+
+/**
+ * Resolves the gop version spec from, in order of precedence: the gop-version
+ * input, the gop-version-file input, a .gop-version file or a gop.mod in dir,
+ * falling back to latest.
+ * @returns {VersionInput} The spec and the source it was read from.
+ */
+export function resolveVersionInput(dir = process.cwd()): VersionInput {
+  const version = getInput('GOP_VERSION')
+  const versionFilePath = getInput('GOP_VERSION_FILE')
 
   if (version && versionFilePath) {
-    core.warning(
+    log.warning(
       'Both gop-version and gop-version-file inputs are specified, only gop-version will be used'
     )
   }
 
+  let input: VersionInput = { spec: '', source: 'latest' }
   if (version) {
-    return version
-  }
-
-  if (versionFilePath) {
+    input = { spec: resolveEnvIndirection(version), source: 'gop-version' }
+  } else if (versionFilePath) {
     if (!fs.existsSync(versionFilePath)) {
       throw new Error(
         `The specified gop version file at: ${versionFilePath} does not exist`
       )
     }
-    version = parseGopVersionFile(versionFilePath)
+    input = {
+      spec: parseGopVersionFile(versionFilePath),
+      source: 'gop-version-file'
+    }
+  } else if (fs.existsSync(path.join(dir, '.gop-version'))) {
+    input = {
+      spec: parseGopVersionFile(path.join(dir, '.gop-version')),
+      source: '.gop-version'
+    }
+  } else if (fs.existsSync(path.join(dir, 'gop.mod'))) {
+    input = {
+      spec: parseGopVersionFile(path.join(dir, 'gop.mod')),
+      source: 'gop.mod'
+    }
+  }
+  if (!input.spec) {
+    input = { spec: '', source: 'latest' }
   }
+  log.debug(`Using gop-version '${input.spec}' from ${input.source}`)
+  return input
+}
 
-  return version
+// Resolves a value of the form env:NAME to the value of the environment
+// variable NAME, other values are returned as is.
+export function resolveEnvIndirection(value: string): string {
+  const match = value.trim().match(/^env:(\w+)$/)
+  if (!match) {
+    return value
+  }
+  const resolved = process.env[match[1]]
+  if (!resolved) {
+    throw new Error(
+      `The environment variable ${match[1]} referenced by gop-version is not set`
+    )
+  }
+  log.info(
+    `Resolved gop-version ${resolved} from environment variable ${match[1]}`
+  )
+  return resolved
 }
 
 export function parseGopVersionFile(versionFilePath: string): string {
@@ -170,9 +2560,72 @@ export function parseGopVersionFile(versionFilePath: string): string {
     path.basename(versionFilePath) === 'gop.mod' ||
     path.basename(versionFilePath) === 'gop.work'
   ) {
-    const match = contents.match(/^gop (\d+(\.\d+)*)/m)
-    return match ? match[1] : ''
+    const match =
+      contents.match(/^gop (\d+(\.\d+)*)/m) ||
+      contents.match(/^toolchain\s+gop\s*v?(\d+\.\d+\.\d+\S*)/m)
+    return match ? match[1] : parseGoModDirective(contents, 'tool')
+  }
+
+  if (path.basename(versionFilePath) === 'go.mod') {
+    return (
+      parseGoModDirective(contents, 'require') ||
+      parseGoModDirective(contents, 'tool')
+    )
+  }
+
+  // Taskfiles and Makefiles pin the version in a GOP_VERSION variable, like
+  // GOP_VERSION: 1.2.3 under vars or GOP_VERSION := 1.2.3.
+  if (/^Taskfile\.ya?ml$/.test(path.basename(versionFilePath))) {
+    const match = contents.match(
+      /^[ \t]*GOP_VERSION:[ \t]*(['"]?)([^'"\s#]+)\1[ \t]*(#.*)?\r?$/m
+    )
+    return match ? match[2] : ''
+  }
+  if (/^(GNUm|m|M)akefile$/.test(path.basename(versionFilePath))) {
+    const match = contents.match(
+      /^(export |override )?GOP_VERSION[ \t]*(::?=|\?=|=)[ \t]*([^\s#]+)/m
+    )
+    return match ? match[3] : ''
+  }
+
+  // Plain version files like .gop-version hold the version on the first line
+  // that is not blank or a # comment, as version managers write them.
+  for (const line of contents.split(/\r?\n/)) {
+    const version = line.replace(/#.*$/, '').trim()
+    if (version) {
+      return version
+    }
   }
+  return ''
+}
 
-  return contents.trim()
+// Finds the version of the gop module in the given directives of a go.mod,
+// require or tool, supporting both the single-line and the block form. A tool
+// may name a command of the module, like github.com/goplus/gop/cmd/gop.
+function parseGoModDirective(contents: string, directive: string): string {
+  let inBlock = false
+  for (const rawLine of contents.split('\n')) {
+    let line = rawLine.replace(/\/\/.*$/, '').trim()
+    if (inBlock) {
+      if (line === ')') {
+        inBlock = false
+        continue
+      }
+    } else if (new RegExp(`^${directive}\\s*\\($`).test(line)) {
+      inBlock = true
+      continue
+    } else if (line.startsWith(`${directive} `)) {
+      line = line.slice(directive.length + 1).trim()
+    } else {
+      continue
+    }
+    const [modPath, version] = line.split(/\s+/)
+    const isGop =
+      modPath === GOPLUS_MODULE ||
+      (directive === 'tool' && modPath.startsWith(`${GOPLUS_MODULE}/`))
+    if (isGop && version) {
+      return version.replace(/^v/, '')
+    }
+  }
+  return ''
 }
@@ -0,0 +1,130 @@
+/**
+ * Cross-process locks, so that parallel runs of the action on one self-hosted
+ * runner do not install to the same directory at once.
+ */
+import crypto from 'crypto'
+import fs from 'fs'
+import path from 'path'
+import { cacheRoot } from './cache'
+import { sleep } from './http'
+import * as log from './logger'
+
+export interface LockOptions {
+  // Gives up waiting for the lock after this many milliseconds.
+  timeout?: number
+  // Interval between attempts to take the lock, in milliseconds.
+  poll?: number
+  sleep?: (ms: number) => Promise<void>
+}
+
+// Returns the path of the lock file guarding dir.
+export function lockPath(dir: string, root: string = cacheRoot()): string {
+  const hash = crypto
+    .createHash('sha256')
+    .update(path.resolve(dir))
+    .digest('hex')
+  return path.join(root, 'locks', `${hash.slice(0, 16)}.lock`)
+}
+
+// A lock is stale when the process holding it is gone, e.g. killed with a
+// cancelled job. A lock without a pid yet is being taken right now.
+function isStale(file: string): boolean {
+  let pid: number
+  try {
+    pid = parseInt(fs.readFileSync(file).toString(), 10)
+  } catch (error) {
+    return false
+  }
+  if (!pid) {
+    return false
+  }
+  try {
+    process.kill(pid, 0)
+    return false
+  } catch (error) {
+    return (error as NodeJS.ErrnoException).code === 'ESRCH'
+  }
+}
+
+// How long taking over a stale lock may take. A takeover guard older than this
+// was left by a waiter killed while taking over.
+const TAKEOVER_TIMEOUT = 10 * 1000
+
+// Creates file unless it exists, reporting whether it was created.
+function createExclusive(file: string): boolean {
+  try {
+    fs.writeFileSync(file, `${process.pid}`, { flag: 'wx' })
+    return true
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code !== 'EEXIST') {
+      throw error
+    }
+    return false
+  }
+}
+
+// Removes the lock file if it is stale. Waiters check and remove it only while
+// holding a takeover guard, so that of two waiters finding the same stale
+// lock, the second never removes the lock the first has taken since.
+function removeIfStale(file: string): void {
+  const guard = `${file}.takeover`
+  if (!createExclusive(guard)) {
+    try {
+      if (Date.now() - fs.statSync(guard).mtimeMs > TAKEOVER_TIMEOUT) {
+        fs.rmSync(guard, { force: true })
+      }
+    } catch (error) {
+      log.debug(`Takeover guard ${guard} released: ${error}`)
+    }
+    return
+  }
+  try {
+    if (isStale(file)) {
+      log.warning(`Removing the stale lock ${file}`)
+      fs.rmSync(file, { force: true })
+    }
+  } finally {
+    fs.rmSync(guard, { force: true })
+  }
+}
+
+function tryLock(file: string): boolean {
+  if (createExclusive(file)) {
+    return true
+  }
+  removeIfStale(file)
+  return false
+}
+
+/**
+ * Runs fn while holding the lock file, waiting for other processes holding it
+ * to finish first.
+ * @returns {Promise<T>} The result of fn.
+ */
+export async function withLock<T>(
+  file: string,
+  fn: () => Promise<T>,
+  options: LockOptions = {}
+): Promise<T> {
+  const timeout = options.timeout ?? 30 * 60 * 1000
+  const poll = options.poll ?? 1000
+  const wait = options.sleep ?? sleep
+  fs.mkdirSync(path.dirname(file), { recursive: true })
+  const deadline = Date.now() + timeout
+  let waiting = false
+  while (!tryLock(file)) {
+    if (Date.now() >= deadline) {
+      throw new Error(`Timed out waiting for the lock ${file}`)
+    }
+    if (!waiting) {
+      log.info(`Waiting for another run installing gop, holding ${file}`)
+      waiting = true
+    }
+    await wait(poll)
+  }
+  try {
+    return await fn()
+  } finally {
+    fs.rmSync(file, { force: true })
+  }
+}
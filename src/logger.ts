@@ -0,0 +1,131 @@
+/**
+ * Logging helpers used throughout the action instead of calling @actions/core
+ * directly, so that plain log lines can be routed to a configurable stream.
+ */
+import * as core from '@actions/core'
+import os from 'os'
+
+export type LogStream = 'stdout' | 'stderr'
+
+let logStream: LogStream = 'stdout'
+
+export function setLogStream(stream: string): void {
+  if (stream !== 'stdout' && stream !== 'stderr') {
+    throw new Error(`Invalid log-stream '${stream}', expected stdout or stderr`)
+  }
+  logStream = stream
+}
+
+export function getLogStream(): LogStream {
+  return logStream
+}
+
+// Writes a plain log line to the configured stream.
+export function info(message: string): void {
+  if (logStream === 'stderr') {
+    process.stderr.write(message + os.EOL)
+  } else {
+    core.info(message)
+  }
+}
+
+// How many warnings are downgraded to plain log lines: none, only advisories
+// or all of them.
+export type Quiet = 'off' | 'advisories' | 'all'
+
+let quiet: Quiet = 'off'
+
+// Sets the quiet level from the quiet input: true downgrades advisories, all
+// downgrades every warning.
+export function setQuiet(value: string): void {
+  if (value === '' || value === 'false') {
+    quiet = 'off'
+  } else if (value === 'true') {
+    quiet = 'advisories'
+  } else if (value === 'all') {
+    quiet = 'all'
+  } else {
+    throw new Error(`Invalid quiet '${value}', expected true, false or all`)
+  }
+}
+
+export function getQuiet(): Quiet {
+  return quiet
+}
+
+// Annotations always go through @actions/core so that GitHub picks them up,
+// unless fully quiet.
+export function warning(message: string): void {
+  if (quiet === 'all') {
+    info(message)
+  } else {
+    core.warning(message)
+  }
+}
+
+// Writes an advisory, a warning about a default the workflow may rely on
+// deliberately, like installing latest without a gop-version. When quiet, it
+// is a plain log line instead of an annotation on every run.
+export function advisory(message: string): void {
+  if (quiet === 'off') {
+    core.warning(message)
+  } else {
+    info(message)
+  }
+}
+
+let debugEnabled = false
+
+// Enables debug output without step debug logging, e.g. by the debug input.
+export function setDebug(enabled: boolean): void {
+  debugEnabled = enabled
+}
+
+// Debug output is active with step debug logging (RUNNER_DEBUG=1) or when
+// enabled by setDebug.
+export function isDebug(): boolean {
+  return debugEnabled || core.isDebug()
+}
+
+// Writes a debug line, with fields appended as JSON. GitHub only shows
+// ::debug:: lines with step debug logging, so when enabled by setDebug alone
+// they are written as plain ##[debug] lines instead.
+export function debug(message: string, fields?: object): void {
+  const line = fields ? `${message} ${JSON.stringify(fields)}` : message
+  if (debugEnabled && !core.isDebug()) {
+    info(`##[debug]${line}`)
+  } else {
+    core.debug(line)
+  }
+}
+
+export function startGroup(name: string): void {
+  core.startGroup(name)
+}
+
+export function endGroup(): void {
+  core.endGroup()
+}
+
+// Runs fn inside a collapsible log group, closing it even if fn throws so that
+// later output is not swallowed by the group.
+export function group<T>(name: string, fn: () => T): T {
+  startGroup(name)
+  try {
+    return fn()
+  } finally {
+    endGroup()
+  }
+}
+
+export async function groupAsync<T>(
+  name: string,
+  fn: () => Promise<T>
+): Promise<T> {
+  startGroup(name)
+  try {
+    return await fn()
+  } finally {
+    endGroup()
+  }
+}
@@ -0,0 +1,179 @@
+/**
+ * Helpers describing the platform the action runs on, in Go's terms.
+ */
+import * as semver from 'semver'
+import fs from 'fs'
+import os from 'os'
+import { execSync } from 'child_process'
+import * as log from './logger'
+
+const GOOS: Record<string, string> = {
+  win32: 'windows',
+  darwin: 'darwin',
+  linux: 'linux',
+  freebsd: 'freebsd',
+  openbsd: 'openbsd',
+  aix: 'aix',
+  sunos: 'solaris'
+}
+
+// Maps the architecture names of Node.js, uname -m and common aliases to
+// GOARCH.
+const GOARCH: Record<string, string> = {
+  x64: 'amd64',
+  amd64: 'amd64',
+  x86_64: 'amd64',
+  ia32: '386',
+  x86: '386',
+  i386: '386',
+  i686: '386',
+  arm64: 'arm64',
+  aarch64: 'arm64',
+  arm: 'arm',
+  armv7l: 'arm',
+  ppc64: 'ppc64',
+  ppc64le: 'ppc64le',
+  s390x: 's390x',
+  riscv64: 'riscv64'
+}
+
+export interface Platform {
+  goos: string
+  goarch: string
+}
+
+// Returns the GOARCH of an architecture name or alias, e.g. x86_64 or aarch64.
+export function normalizeGoarch(arch: string): string {
+  const name = arch.trim().toLowerCase()
+  return GOARCH[name] || name
+}
+
+// Returns the platform the action runs on in Go's terms.
+export function detectPlatform(
+  platform: NodeJS.Platform = process.platform,
+  arch: string = process.arch
+): Platform {
+  return { goos: GOOS[platform] || platform, goarch: normalizeGoarch(arch) }
+}
+
+export function hostGoos(): string {
+  return detectPlatform().goos
+}
+
+export function hostGoarch(): string {
+  return detectPlatform().goarch
+}
+
+// Returns the separator of PATH entries on platform.
+export function pathDelimiter(
+  platform: NodeJS.Platform = process.platform
+): string {
+  return platform === 'win32' ? ';' : ':'
+}
+
+// Returns the file name of the executable name on platform, e.g. gop.exe.
+export function executableName(
+  name: string,
+  platform: NodeJS.Platform = process.platform
+): string {
+  return platform === 'win32' ? `${name}.exe` : name
+}
+
+// Reports whether env targets a GOOS/GOARCH other than the host's.
+export function isCrossBuild(env: NodeJS.ProcessEnv): boolean {
+  const goos = env['GOOS']
+  const goarch = env['GOARCH']
+  return (
+    (!!goos && goos !== hostGoos()) || (!!goarch && goarch !== hostGoarch())
+  )
+}
+
+export interface OsInfo {
+  id: string
+  version: string
+}
+
+// Minimum OS versions of the Go toolchains gop is built with, newest first, as
+// announced in the Go release notes: https://go.dev/doc/go1.21#darwin,
+// https://go.dev/doc/go1.23#darwin, https://go.dev/doc/go1.24#linux and
+// https://go.dev/doc/go1.25#darwin. Linux floors are kernel versions.
+const OS_FLOORS: { go: string; id: string; version: string }[] = [
+  { go: '>=1.24.0-0', id: 'linux', version: '3.2' },
+  { go: '>=1.25.0-0', id: 'macos', version: '12' },
+  { go: '>=1.23.0-0', id: 'macos', version: '11' },
+  { go: '>=1.21.0-0', id: 'macos', version: '10.15' }
+]
+
+export function parseOsRelease(contents: string): OsInfo {
+  const fields: Record<string, string> = {}
+  for (const line of contents.split(/\r?\n/)) {
+    const match = line.match(/^([A-Z_]+)=(.*)$/)
+    if (match) {
+      fields[match[1]] = match[2].trim().replace(/^(['"])(.*)\1$/, '$2')
+    }
+  }
+  return { id: fields['ID'] || '', version: fields['VERSION_ID'] || '' }
+}
+
+// Detects the runner OS on a best-effort basis, returning null if unknown.
+export function detectOs(): OsInfo | null {
+  try {
+    if (process.platform === 'linux') {
+      return parseOsRelease(fs.readFileSync('/etc/os-release').toString())
+    }
+    if (process.platform === 'darwin') {
+      const version = execSync('sw_vers -productVersion').toString().trim()
+      return { id: 'macos', version }
+    }
+  } catch (error) {
+    log.debug(`Unable to detect the runner OS: ${error}`)
+  }
+  return null
+}
+
+// Returns the minimum OS version of the go reporting goVersion, like go1.22.1,
+// if info is below it, or an empty string otherwise.
+export function osBelowFloor(info: OsInfo, goVersion: string): string {
+  const actual = semver.coerce(info.version)
+  const go = semver.coerce(goVersion)
+  if (!actual || !go) {
+    return ''
+  }
+  const floor = OS_FLOORS.find(
+    f => f.id === info.id && semver.satisfies(go, f.go)
+  )
+  if (!floor) {
+    return ''
+  }
+  const minimum = semver.coerce(floor.version)
+  return minimum && semver.lt(actual, minimum) ? floor.version : ''
+}
+
+// Returns what the floors of OS_FLOORS are checked against: the kernel on
+// Linux, as Go's requirements name no distributions, or else info.
+export function floorSubject(
+  info: OsInfo | null,
+  platform: string = process.platform,
+  release: () => string = os.release
+): OsInfo | null {
+  return platform === 'linux' ? { id: 'linux', version: release() } : info
+}
+
+// Logs the runner OS and warns if it is older than goVersion, the go a build
+// runs, supports.
+export function preflightOs(goVersion: string): void {
+  const detected = detectOs()
+  if (detected && detected.id) {
+    log.info(`Runner OS: ${detected.id} ${detected.version}`)
+  }
+  const info = floorSubject(detected)
+  if (!info || !info.id) {
+    return
+  }
+  const floor = osBelowFloor(info, goVersion)
+  if (floor) {
+    log.warning(
+      `Runner OS ${info.id} ${info.version} is older than ${info.id} ${floor}, which ${goVersion} requires, building gop may fail`
+    )
+  }
+}
@@ -0,0 +1,83 @@
+/**
+ * Progress reporting for long downloads, so the log does not look frozen.
+ */
+import * as log from './logger'
+
+export type ProgressReport = (message: string) => void
+
+function formatMiB(bytes: number): string {
+  return `${(bytes / (1024 * 1024)).toFixed(1)} MiB`
+}
+
+export interface ProgressCounter {
+  // Counts bytes more as read.
+  add(bytes: number): void
+  // Ends the download, reporting its size if the total was unknown.
+  done(): void
+}
+
+/**
+ * Returns a counter of the bytes read of a total byte download, reporting the
+ * percentage done each time it passes another step percent. Nothing is
+ * reported while the total is unknown, only once the download is done.
+ * @returns {ProgressCounter} The counter.
+ */
+export function progressCounter(
+  label: string,
+  total: number,
+  step = 5,
+  report: ProgressReport = log.info
+): ProgressCounter {
+  let read = 0
+  let reported = 0
+  return {
+    add(bytes: number): void {
+      read += bytes
+      if (total <= 0) {
+        return
+      }
+      const percent = Math.floor((read * 100) / total)
+      const milestone = percent >= 100 ? 100 : percent - (percent % step)
+      if (milestone > reported) {
+        reported = milestone
+        const size = `${formatMiB(read)} of ${formatMiB(total)}`
+        report(`${label}: ${milestone}% (${size})`)
+      }
+    },
+    done(): void {
+      if (total <= 0) {
+        report(`${label}: ${formatMiB(read)}`)
+      }
+    }
+  }
+}
+
+/**
+ * Reads the body of res to the end, reporting progress every step percent of
+ * its Content-Length.
+ * @returns {Promise<Buffer>} The body.
+ */
+export async function progressReader(
+  res: Response,
+  label: string,
+  step = 5,
+  report: ProgressReport = log.info
+): Promise<Buffer> {
+  if (!res.body) {
+    return Buffer.from(await res.arrayBuffer())
+  }
+  const total = Number(res.headers.get('content-length')) || 0
+  const counter = progressCounter(label, total, step, report)
+  const chunks: Buffer[] = []
+  const reader = res.body.getReader()
+  for (;;) {
+    const { done, value } = await reader.read()
+    if (done) {
+      break
+    }
+    chunks.push(Buffer.from(value))
+    counter.add(value.byteLength)
+  }
+  counter.done()
+  return Buffer.concat(chunks)
+}
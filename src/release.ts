@@ -0,0 +1,199 @@
+/**
+ * Installs gop from the prebuilt archives attached to its GitHub releases.
+ */
+import fs from 'fs'
+import os from 'os'
+import path from 'path'
+import { extractArchive } from './archive'
+import { gopBinaries } from './cache'
+import { parseChecksums, verifyChecksum } from './checksum'
+import { GITHUB_URL, isGitHubUrl } from './github'
+import { moveToGopRoot } from './goproot'
+import { fetchWithRetry } from './http'
+import * as log from './logger'
+import { progressReader } from './progress'
+
+export const GOPLUS_RELEASES_API =
+  'https://api.github.com/repos/goplus/gop/releases'
+
+export interface ReleaseAsset {
+  name: string
+  browser_download_url: string
+}
+
+export interface DownloadOptions {
+  // Directory the gop binaries are installed to.
+  binDir: string
+  // Directory the tree of the release is kept in as the gop root, if given.
+  rootDir?: string
+  // GitHub token, to raise the API rate limit.
+  token?: string
+  // Expected SHA256 of the archive, or the URL of a checksums file listing it.
+  checksum?: string
+  // Releases API of the gop repo, GOPLUS_RELEASES_API by default.
+  apiUrl?: string
+  // The GitHub instance the token belongs to, github.com by default. The
+  // token is only sent to its hosts.
+  serverUrl?: string
+}
+
+// Finds the archive for goos/goarch, e.g. gop_v1.2.0_linux_amd64.tar.gz.
+export function findReleaseAsset(
+  assets: ReleaseAsset[],
+  goos: string,
+  goarch: string
+): ReleaseAsset | undefined {
+  const platform = new RegExp(`[_-]${goos}[_-]${goarch}\\.(tar\\.gz|zip)$`)
+  return assets.find(
+    asset => asset.name.startsWith('gop') && platform.test(asset.name)
+  )
+}
+
+// Returns the directory holding the gop binary in an extracted archive.
+export function findGopDir(dir: string): string | null {
+  for (const entry of fs.readdirSync(dir, { withFileTypes: true })) {
+    if (entry.isFile() && (entry.name === 'gop' || entry.name === 'gop.exe')) {
+      return dir
+    }
+  }
+  for (const entry of fs.readdirSync(dir, { withFileTypes: true })) {
+    if (entry.isDirectory()) {
+      const found = findGopDir(path.join(dir, entry.name))
+      if (found) {
+        return found
+      }
+    }
+  }
+  return null
+}
+
+// Returns the gop root in an extracted archive: the closest directory from
+// gopDir, the one holding the gop binary, up to dir with gop's go.mod.
+export function findReleaseRoot(gopDir: string, dir: string): string | null {
+  for (let root = gopDir; ; root = path.dirname(root)) {
+    if (fs.existsSync(path.join(root, 'go.mod'))) {
+      return root
+    }
+    if (path.relative(dir, root) === '' || path.dirname(root) === root) {
+      return null
+    }
+  }
+}
+
+// Resolves the expected SHA256 of the archive name from checksum, which is
+// either the hash itself or the URL of a checksums file.
+export async function resolveChecksum(
+  checksum: string,
+  name: string,
+  headers: Record<string, string> = {}
+): Promise<string> {
+  if (!/^https?:\/\//.test(checksum)) {
+    return checksum
+  }
+  const res = await fetchWithRetry(checksum, { headers })
+  if (!res.ok) {
+    throw new Error(`Failed to download ${checksum}: HTTP ${res.status}`)
+  }
+  const expected = parseChecksums(await res.text(), name)
+  if (!expected) {
+    throw new Error(`No checksum for ${name} found in ${checksum}`)
+  }
+  return expected
+}
+
+/**
+ * Downloads the prebuilt gop archive of version for goos/goarch and installs
+ * its binaries to options.binDir, keeping the rest of the release tree in
+ * options.rootDir as the gop root.
+ * @returns {Promise<string | null>} The bin directory, or null if the release
+ * has no archive for the platform.
+ */
+export async function downloadRelease(
+  version: string,
+  goos: string,
+  goarch: string,
+  options: DownloadOptions
+): Promise<string | null> {
+  const serverUrl = options.serverUrl || GITHUB_URL
+  // Never leak the token to hosts outside the GitHub instance, like one
+  // serving a checksums file.
+  const authFor = (target: string): Record<string, string> =>
+    options.token && isGitHubUrl(target, serverUrl)
+      ? { Authorization: `Bearer ${options.token}` }
+      : {}
+  const url = `${options.apiUrl || GOPLUS_RELEASES_API}/tags/v${version}`
+  const res = await fetchWithRetry(url, {
+    headers: { Accept: 'application/vnd.github+json', ...authFor(url) }
+  })
+  if (res.status === 404) {
+    log.info(`No gop release found for v${version}`)
+    return null
+  }
+  if (!res.ok) {
+    throw new Error(
+      `Failed to fetch gop release v${version}: HTTP ${res.status}`
+    )
+  }
+  const release = (await res.json()) as { assets?: ReleaseAsset[] }
+  const asset = findReleaseAsset(release.assets || [], goos, goarch)
+  if (!asset) {
+    log.info(`No prebuilt gop v${version} for ${goos}/${goarch}`)
+    return null
+  }
+
+  log.info(`Downloading ${asset.browser_download_url} ...`)
+  const download = await fetchWithRetry(asset.browser_download_url, {
+    headers: authFor(asset.browser_download_url)
+  })
+  if (!download.ok) {
+    throw new Error(`Failed to download ${asset.name}: HTTP ${download.status}`)
+  }
+  const tmpDir = fs.mkdtempSync(path.join(os.tmpdir(), 'setup-goplus-'))
+  try {
+    const archive = path.join(tmpDir, asset.name)
+    fs.writeFileSync(
+      archive,
+      await progressReader(download, `Downloading ${asset.name}`)
+    )
+    if (options.checksum) {
+      verifyChecksum(
+        archive,
+        await resolveChecksum(
+          options.checksum,
+          asset.name,
+          authFor(options.checksum)
+        )
+      )
+      log.info(`Verified the SHA256 checksum of ${asset.name}`)
+    } else {
+      log.info(
+        `Skipped checksum verification of ${asset.name}, no checksum set`
+      )
+    }
+    const extractDir = path.join(tmpDir, 'extract')
+    extractArchive(archive, extractDir)
+    const gopDir = findGopDir(extractDir)
+    if (!gopDir) {
+      throw new Error(`No gop binary found in ${asset.name}`)
+    }
+    fs.mkdirSync(options.binDir, { recursive: true })
+    for (const name of gopBinaries(gopDir)) {
+      const dest = path.join(options.binDir, name)
+      fs.copyFileSync(path.join(gopDir, name), dest)
+      fs.chmodSync(dest, 0o755)
+    }
+    if (options.rootDir) {
+      const root = findReleaseRoot(gopDir, extractDir)
+      if (root) {
+        moveToGopRoot(root, options.rootDir)
+      } else {
+        fs.rmSync(options.rootDir, { recursive: true, force: true })
+        log.warning(`No gop root found in ${asset.name}, GOPROOT is not set`)
+      }
+    }
+    log.info(`Installed prebuilt gop v${version} to ${options.binDir}`)
+    return options.binDir
+  } finally {
+    fs.rmSync(tmpDir, { recursive: true, force: true })
+  }
+}
@@ -0,0 +1,62 @@
+/**
+ * A machine-readable summary of the install, for the gop-install-summary
+ * output and the job summary.
+ */
+import * as core from '@actions/core'
+
+// Where the gop binaries came from, also the gop-install-source output: cache,
+// release or source for binaries restored from the cache, downloaded or built,
+// and path for a matching gop already on the PATH.
+export type InstallSource = 'cache' | 'release' | 'source' | 'path'
+
+export interface InstallSummary {
+  // The installed gop version, as reported by gop itself.
+  version: string
+  // Whether gop was checked to report the version selected from the tags.
+  verified: boolean
+  source: InstallSource
+  repo: string
+  // The tag, branch or commit installed.
+  ref: string
+  durationMs: number
+  // Total time of each phase, like clone or build, in milliseconds.
+  phasesMs: Record<string, number>
+}
+
+export function summaryRows(summary: InstallSummary): string[][] {
+  return [
+    ['Version', summary.version],
+    ['Verified', String(summary.verified)],
+    ['Source', summary.source],
+    ['Repository', summary.repo],
+    ['Ref', summary.ref],
+    ['Duration', seconds(summary.durationMs)],
+    [
+      'Phases',
+      Object.entries(summary.phasesMs)
+        .map(([phase, ms]) => `${phase} ${seconds(ms)}`)
+        .join(', ')
+    ]
+  ]
+}
+
+function seconds(ms: number): string {
+  return `${(ms / 1000).toFixed(1)}s`
+}
+
+// Writes summary as a table to the job summary, if GITHUB_STEP_SUMMARY is set.
+export async function writeStepSummary(summary: InstallSummary): Promise<void> {
+  if (!process.env['GITHUB_STEP_SUMMARY']) {
+    return
+  }
+  await core.summary
+    .addHeading('Setup Go+', 3)
+    .addTable([
+      [
+        { data: 'Field', header: true },
+        { data: 'Value', header: true }
+      ],
+      ...summaryRows(summary)
+    ])
+    .write()
+}
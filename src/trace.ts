@@ -0,0 +1,78 @@
+/**
+ * Records how long each phase of the action takes, for writing as a Chrome
+ * trace (chrome://tracing, Perfetto) to compare runs across runner types.
+ */
+import fs from 'fs'
+
+export interface Span {
+  name: string
+  // Start and end times in milliseconds, as returned by the clock.
+  start: number
+  end: number
+}
+
+export class Tracer {
+  private readonly spans: Span[] = []
+
+  // onSpan is called with each span as it ends, e.g. to log its duration.
+  constructor(
+    private readonly clock: () => number = Date.now,
+    private readonly onSpan: (span: Span) => void = () => {}
+  ) {}
+
+  // Runs fn, recording it as a span named name even if it throws.
+  span<T>(name: string, fn: () => T): T {
+    const start = this.clock()
+    try {
+      return fn()
+    } finally {
+      this.end(name, start)
+    }
+  }
+
+  async spanAsync<T>(name: string, fn: () => Promise<T>): Promise<T> {
+    const start = this.clock()
+    try {
+      return await fn()
+    } finally {
+      this.end(name, start)
+    }
+  }
+
+  private end(name: string, start: number): void {
+    const span = { name, start, end: this.clock() }
+    this.spans.push(span)
+    this.onSpan(span)
+  }
+
+  getSpans(): Span[] {
+    return [...this.spans]
+  }
+
+  // Sums the durations of the spans by name, in milliseconds.
+  totals(): Record<string, number> {
+    const totals: Record<string, number> = {}
+    for (const s of this.spans) {
+      totals[s.name] = (totals[s.name] || 0) + s.end - s.start
+    }
+    return totals
+  }
+
+  // Formats the spans as complete events of the Chrome trace event format,
+  // which uses microseconds.
+  toChromeTrace(): string {
+    const traceEvents = this.spans.map(s => ({
+      name: s.name,
+      ph: 'X',
+      ts: s.start * 1000,
+      dur: (s.end - s.start) * 1000,
+      pid: process.pid,
+      tid: 1
+    }))
+    return JSON.stringify({ traceEvents }, null, 2)
+  }
+
+  write(tracePath: string): void {
+    fs.writeFileSync(tracePath, this.toChromeTrace())
+  }
+}